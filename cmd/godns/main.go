@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -19,16 +20,38 @@ func main() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
 	dnsServer := server.NewDnsServer(ctx)
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		args := dnsServer.ParseExplainArgs(os.Args[2:])
+		setLogLevel(dnsServer.Config.LogLevel)
+		dnsServer.RunExplain(args)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		args := dnsServer.ParseCheckArgs(os.Args[2:])
+		setLogLevel(dnsServer.Config.LogLevel)
+		dnsServer.RunCheck(args)
+		return
+	}
 	dnsServer.ParseArgs()
 
-	level, err := zerolog.ParseLevel(dnsServer.Config.LogLevel)
-	if err != nil {
-		panic(err)
-	}
-	zerolog.SetGlobalLevel(level)
+	setLogLevel(dnsServer.Config.LogLevel)
 
 	dnsServer.SetupRouter()
 	dnsServer.SetupServer()
 	dnsServer.SetupPprof()
+	dnsServer.SetupAdmin()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	dnsServer.SetupReload(reload)
+
 	dnsServer.Start()
 }
+
+func setLogLevel(logLevel string) {
+	level, err := zerolog.ParseLevel(logLevel)
+	if err != nil {
+		panic(err)
+	}
+	zerolog.SetGlobalLevel(level)
+}
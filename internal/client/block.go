@@ -2,31 +2,82 @@ package client
 
 import (
 	"context"
+	"net"
 
 	"github.com/miekg/dns"
 	"github.com/rs/zerolog"
-)
 
-type BlockByNodata struct{}
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
 
-func (*BlockByNodata) Resolve(ctx context.Context, question dns.Question, dnssec bool) ([]dns.RR, error) {
-	zerolog.Ctx(ctx).
-		Debug().
-		Str("module", "client.block.nodata").
-		Str("domain", question.Name).
-		Str("record", dns.TypeToString[question.Qtype]).
-		Msg("resolved")
-	return nil, nil
+type Block struct {
+	action string
+	ipv4   net.IP
+	ipv6   net.IP
+	soa    bool
 }
 
-type BlockByNxdomain struct{}
+func createBlockResolver(upstream *config.Upstream) DnsResolver {
+	client := &Block{
+		action: upstream.Block,
+		soa:    upstream.BlockSoa,
+		ipv4:   net.IPv4zero,
+		ipv6:   net.IPv6unspecified,
+	}
+	if upstream.BlockIpv4 != "" {
+		client.ipv4 = net.ParseIP(upstream.BlockIpv4)
+	}
+	if upstream.BlockIpv6 != "" {
+		client.ipv6 = net.ParseIP(upstream.BlockIpv6)
+	}
+	return client
+}
 
-func (*BlockByNxdomain) Resolve(ctx context.Context, question dns.Question, dnssec bool) ([]dns.RR, error) {
-	zerolog.Ctx(ctx).
-		Debug().
-		Str("module", "client.block.nxdomain").
+func (b *Block) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.block."+b.action).
 		Str("domain", question.Name).
 		Str("record", dns.TypeToString[question.Qtype]).
-		Msg("resolved")
-	return nil, &ErrDnsResponse{Rcode: dns.RcodeNameError}
+		Logger()
+
+	msg := new(dns.Msg)
+	switch b.action {
+	case "nxdomain":
+		msg.Rcode = dns.RcodeNameError
+	case "refused":
+		msg.Rcode = dns.RcodeRefused
+	case "sinkhole":
+		if question.Qtype == dns.TypeA {
+			rr := new(dns.A)
+			rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}
+			rr.A = b.ipv4
+			msg.Answer = []dns.RR{rr}
+		} else if question.Qtype == dns.TypeAAAA {
+			rr := new(dns.AAAA)
+			rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60}
+			rr.AAAA = b.ipv6
+			msg.Answer = []dns.RR{rr}
+		}
+	}
+	if b.soa && len(msg.Answer) == 0 && msg.Rcode != dns.RcodeRefused {
+		msg.Ns = []dns.RR{blockSoa(question.Name)}
+	}
+
+	logger.Debug().Msg("resolved")
+	return msg, nil
+}
+
+// blockSoa lets clients cache the negative answer for a minute, RFC 2308.
+func blockSoa(name string) dns.RR {
+	rr := new(dns.SOA)
+	rr.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60}
+	rr.Ns = "localhost."
+	rr.Mbox = "nobody.invalid."
+	rr.Serial = 1
+	rr.Refresh = 3600
+	rr.Retry = 600
+	rr.Expire = 86400
+	rr.Minttl = 60
+	return rr
 }
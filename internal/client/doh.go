@@ -45,7 +45,7 @@ func createDohResolver(ctx context.Context, doh string, dohProxy string) DnsReso
 	}
 }
 
-func (s *Doh) Resolve(ctx context.Context, question dns.Question, dnssec bool) ([]dns.RR, error) {
+func (s *Doh) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
 	logger := zerolog.Ctx(ctx).
 		With().
 		Str("module", "client.doh").
@@ -85,11 +85,13 @@ func (s *Doh) Resolve(ctx context.Context, question dns.Question, dnssec bool) (
 		return nil, err
 	}
 
+	msg := new(dns.Msg)
+	msg.Rcode = r.Status
 	if r.Status != 0 {
 		logger.Debug().
 			Str("rcode", dns.RcodeToString[r.Status]).
 			Msg("failed to resolve")
-		return nil, &ErrDnsResponse{Rcode: r.Status}
+		return msg, nil
 	}
 
 	answers := []dns.RR{}
@@ -122,9 +124,10 @@ func (s *Doh) Resolve(ctx context.Context, question dns.Question, dnssec bool) (
 			answers = append(answers, rr)
 		}
 	}
+	msg.Answer = answers
 
 	logger.Debug().Msg("resolved")
-	return answers, nil
+	return msg, nil
 }
 
 // https://developers.cloudflare.com/1.1.1.1/encryption/dns-over-https/make-api-requests/dns-json/
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+// EmptyZone answers a locally-served empty zone (RFC 6303).
+type EmptyZone struct {
+	zone string
+}
+
+func (z *EmptyZone) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.empty_zone").
+		Str("zone", z.zone).
+		Str("domain", question.Name).
+		Str("record", dns.TypeToString[question.Qtype]).
+		Logger()
+
+	msg := new(dns.Msg)
+	msg.Authoritative = true
+
+	if dns.CanonicalName(question.Name) != z.zone {
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = []dns.RR{z.soa()}
+	} else if question.Qtype == dns.TypeSOA {
+		msg.Answer = []dns.RR{z.soa()}
+	} else if question.Qtype == dns.TypeNS {
+		msg.Answer = []dns.RR{z.ns()}
+	} else {
+		msg.Ns = []dns.RR{z.soa()}
+	}
+
+	logger.Debug().Str("rcode", dns.RcodeToString[msg.Rcode]).Msg("resolved")
+	return msg, nil
+}
+
+// the SOA and NS records are suggested by RFC 6303 section 3
+func (z *EmptyZone) soa() dns.RR {
+	rr := new(dns.SOA)
+	rr.Hdr = dns.RR_Header{Name: z.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 10800}
+	rr.Ns = "localhost."
+	rr.Mbox = "nobody.invalid."
+	rr.Serial = 1
+	rr.Refresh = 604800
+	rr.Retry = 86400
+	rr.Expire = 2419200
+	rr.Minttl = 10800
+	return rr
+}
+
+func (z *EmptyZone) ns() dns.RR {
+	rr := new(dns.NS)
+	rr.Hdr = dns.RR_Header{Name: z.zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 10800}
+	rr.Ns = "localhost."
+	return rr
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/util"
+)
+
+var ErrHostsNotLoaded = errors.New("hosts is not loaded")
+
+type Hosts struct {
+	watcher *util.FileWatcher
+	data    atomic.Pointer[hostsData]
+	paths   []string
+}
+
+type hostsData struct {
+	addrs map[string][]net.IP // name -> addresses
+	names map[string][]string // reverse name -> names
+}
+
+func createHostsResolver(ctx context.Context, paths []string) DnsResolver {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.hosts").
+		Strs("paths", paths).
+		Logger()
+
+	cacheKey := "hosts|" + strings.Join(paths, "|")
+	if client, found := resolverCache.Get(cacheKey); found {
+		logger.Trace().Msg("get resolver from cache")
+		return client
+	} else {
+		client := &Hosts{paths: paths, watcher: util.MakeFileWatcher(time.Second, paths...)}
+		client.reload(ctx)
+		resolverCache.Set(cacheKey, client)
+		logger.Trace().Msg("new resolver created")
+		return client
+	}
+}
+
+func (h *Hosts) reload(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.hosts").
+		Strs("paths", h.paths).
+		Logger()
+
+	data, err := loadHosts(h.paths)
+	if err != nil {
+		logger.Error().Stack().Err(err).Msg("failed to load hosts")
+		return
+	}
+	h.data.Store(data)
+	logger.Info().Int("names", len(data.addrs)).Msg("hosts loaded")
+}
+
+func (h *Hosts) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.hosts").
+		Str("domain", question.Name).
+		Str("record", dns.TypeToString[question.Qtype]).
+		Logger()
+
+	if h.watcher.Changed() {
+		h.reload(ctx)
+	}
+
+	data := h.data.Load()
+	if data == nil {
+		err := errors.Wrap(ErrHostsNotLoaded, strings.Join(h.paths, ","))
+		logger.Error().Stack().Err(err).Send()
+		return nil, err
+	}
+
+	msg := data.lookup(question)
+	logger.Debug().Str("rcode", dns.RcodeToString[msg.Rcode]).Msg("resolved")
+	return msg, nil
+}
+
+func (h *Hosts) ReverseNames(ctx context.Context, name string) []string {
+	if h.watcher.Changed() {
+		h.reload(ctx)
+	}
+	data := h.data.Load()
+	if data == nil {
+		return nil
+	}
+	return data.names[dns.CanonicalName(name)]
+}
+
+///
+
+func loadHosts(paths []string) (*hostsData, error) {
+	data := &hostsData{
+		addrs: make(map[string][]net.IP),
+		names: make(map[string][]string),
+	}
+	for _, path := range paths {
+		if err := data.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (h *hostsData) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	buf := bufio.NewScanner(f)
+	for buf.Scan() {
+		line := buf.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		addr := fields[0]
+		if idx := strings.IndexByte(addr, '%'); idx >= 0 {
+			addr = addr[:idx]
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		reverse, err := dns.ReverseAddr(ip.String())
+		if err != nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = dns.CanonicalName(name)
+			h.addrs[name] = append(h.addrs[name], ip)
+			h.names[reverse] = append(h.names[reverse], name)
+		}
+	}
+	return errors.WithStack(buf.Err())
+}
+
+func (h *hostsData) lookup(question dns.Question) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.Authoritative = true
+	name := dns.CanonicalName(question.Name)
+
+	if question.Qtype == dns.TypePTR {
+		names, found := h.names[name]
+		if !found {
+			msg.Rcode = dns.RcodeNameError
+			return msg
+		}
+		for _, target := range names {
+			rr := new(dns.PTR)
+			rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 60}
+			rr.Ptr = target
+			msg.Answer = append(msg.Answer, rr)
+		}
+		return msg
+	}
+
+	addrs, found := h.addrs[name]
+	if !found {
+		if _, isReverse := h.names[name]; !isReverse {
+			msg.Rcode = dns.RcodeNameError
+		}
+		return msg
+	}
+	for _, ip := range addrs {
+		isIpv4 := ip.To4() != nil
+		if question.Qtype == dns.TypeA && isIpv4 {
+			rr := new(dns.A)
+			rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}
+			rr.A = ip.To4()
+			msg.Answer = append(msg.Answer, rr)
+		} else if question.Qtype == dns.TypeAAAA && !isIpv4 {
+			rr := new(dns.AAAA)
+			rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60}
+			rr.AAAA = ip
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+	return msg
+}
@@ -12,7 +12,7 @@ type Ipv4 struct {
 	ip net.IP
 }
 
-func (ip *Ipv4) Resolve(ctx context.Context, question dns.Question, dnssec bool) ([]dns.RR, error) {
+func (ip *Ipv4) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
 	logger := zerolog.Ctx(ctx).
 		With().
 		Str("module", "client.ipv4").
@@ -24,8 +24,11 @@ func (ip *Ipv4) Resolve(ctx context.Context, question dns.Question, dnssec bool)
 	rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}
 	rr.A = ip.ip
 
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{rr}
+
 	logger.Debug().Msg("resolved")
-	return []dns.RR{rr}, nil
+	return msg, nil
 }
 
 func createIpv4Resolver(ctx context.Context, ip string) DnsResolver {
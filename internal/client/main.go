@@ -11,21 +11,28 @@ import (
 )
 
 type DnsResolver interface {
-	Resolve(ctx context.Context, question dns.Question, dnssec bool) ([]dns.RR, error)
+	Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error)
+}
+
+// ReverseResolver finds the names of local addresses, by the reverse name like "4.3.2.1.in-addr.arpa.".
+type ReverseResolver interface {
+	ReverseNames(ctx context.Context, name string) []string
 }
 
 var resolverCache = shardmap.New[string, DnsResolver](8)
 
+// ResetResolvers drops the cached resolvers, they are created again for the new config.
+func ResetResolvers() {
+	resolverCache.Clear()
+}
+
 func GetByUpstream(ctx context.Context, upstream *config.Upstream) DnsResolver {
 	if upstream == nil {
 		return nil
 	}
 
-	if upstream.Block == "nodata" {
-		return &BlockByNodata{}
-	}
-	if upstream.Block == "nxdomain" {
-		return &BlockByNxdomain{}
+	if upstream.Block != "" {
+		return createBlockResolver(upstream)
 	}
 	if upstream.Ipv4 != "" {
 		return createIpv4Resolver(ctx, upstream.Ipv4)
@@ -39,6 +46,15 @@ func GetByUpstream(ctx context.Context, upstream *config.Upstream) DnsResolver {
 	if upstream.Doh != "" {
 		return createDohResolver(ctx, upstream.Doh, upstream.DohProxy)
 	}
+	if upstream.Zone != "" {
+		return createZoneResolver(ctx, upstream.Zone, upstream.ZoneOrigin)
+	}
+	if len(upstream.Hosts) > 0 {
+		return createHostsResolver(ctx, upstream.Hosts)
+	}
+	if upstream.EmptyZone != "" {
+		return &EmptyZone{zone: upstream.EmptyZone}
+	}
 
 	zerolog.Ctx(ctx).Error().Str("module", "client.main").Msg("no upstream")
 
@@ -12,7 +12,7 @@ type Udp struct {
 	server string
 }
 
-func (u *Udp) Resolve(ctx context.Context, question dns.Question, dnssec bool) ([]dns.RR, error) {
+func (u *Udp) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
 	logger := zerolog.Ctx(ctx).
 		With().
 		Str("module", "client.udp").
@@ -32,6 +32,6 @@ func (u *Udp) Resolve(ctx context.Context, question dns.Question, dnssec bool) (
 		return nil, err
 	}
 
-	logger.Debug().Msg("resolved")
-	return in.Answer, nil
+	logger.Debug().Str("rcode", dns.RcodeToString[in.Rcode]).Msg("resolved")
+	return in, nil
 }
@@ -0,0 +1,302 @@
+package client
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/util"
+)
+
+var (
+	ErrZoneNotLoaded = errors.New("zone is not loaded")
+	ErrZoneSoa       = errors.New("zone must contain exactly one SOA")
+	ErrZoneOutOfZone = errors.New("record is out of zone")
+	ErrZoneOrigin    = errors.New("no origin, set $ORIGIN or use a single domain or suffix in the rule")
+)
+
+// the max length of a CNAME chain followed inside a zone
+const maxCnameChain = 8
+
+type Zone struct {
+	watcher *util.FileWatcher
+	data    atomic.Pointer[zoneData]
+	path    string
+	origin  string // used if the file has no $ORIGIN
+}
+
+type zoneData struct {
+	soa     *dns.SOA
+	records map[string][]dns.RR
+	names   map[string]struct{} // owner names and empty non-terminals
+	reverse map[string][]string // reverse names of A and AAAA records
+	origin  string
+}
+
+func createZoneResolver(ctx context.Context, path string, origin string) DnsResolver {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.zone").
+		Str("path", path).
+		Logger()
+
+	cacheKey := "zone|" + origin + "|" + path
+	if client, found := resolverCache.Get(cacheKey); found {
+		logger.Trace().Msg("get resolver from cache")
+		return client
+	} else {
+		client := &Zone{path: path, origin: origin, watcher: util.MakeFileWatcher(time.Second, path)}
+		client.reload(ctx)
+		resolverCache.Set(cacheKey, client)
+		logger.Trace().Msg("new resolver created")
+		return client
+	}
+}
+
+func (z *Zone) reload(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.zone").
+		Str("path", z.path).
+		Logger()
+
+	data, err := loadZone(z.path, z.origin)
+	if err != nil {
+		logger.Error().Stack().Err(err).Msg("failed to load zone")
+		return
+	}
+	z.data.Store(data)
+	logger.Info().
+		Str("origin", data.origin).
+		Int("names", len(data.records)).
+		Msg("zone loaded")
+}
+
+func (z *Zone) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "client.zone").
+		Str("domain", question.Name).
+		Str("record", dns.TypeToString[question.Qtype]).
+		Logger()
+
+	if z.watcher.Changed() {
+		z.reload(ctx)
+	}
+
+	data := z.data.Load()
+	if data == nil {
+		err := errors.Wrap(ErrZoneNotLoaded, z.path)
+		logger.Error().Stack().Err(err).Send()
+		return nil, err
+	}
+
+	msg := data.lookup(question)
+	logger.Debug().Str("rcode", dns.RcodeToString[msg.Rcode]).Msg("resolved")
+	return msg, nil
+}
+
+func (z *Zone) ReverseNames(ctx context.Context, name string) []string {
+	if z.watcher.Changed() {
+		z.reload(ctx)
+	}
+	data := z.data.Load()
+	if data == nil {
+		return nil
+	}
+	return data.reverse[dns.CanonicalName(name)]
+}
+
+///
+
+// loadZone parses the zone file, relative names are under the origin.
+func loadZone(path string, origin string) (*zoneData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var rrs []dns.RR
+	var soa *dns.SOA
+	zp := dns.NewZoneParser(f, origin, path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rr.Header().Name = dns.CanonicalName(rr.Header().Name)
+		if s, isSoa := rr.(*dns.SOA); isSoa {
+			if soa != nil {
+				return nil, errors.Wrap(ErrZoneSoa, path)
+			}
+			soa = s
+		}
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		if origin == "" {
+			return nil, errors.Wrap(ErrZoneOrigin, err.Error())
+		}
+		return nil, errors.WithStack(err)
+	}
+	if soa == nil {
+		return nil, errors.Wrap(ErrZoneSoa, path)
+	}
+
+	data := &zoneData{
+		origin:  soa.Hdr.Name,
+		soa:     soa,
+		records: make(map[string][]dns.RR),
+		names:   make(map[string]struct{}),
+		reverse: make(map[string][]string),
+	}
+	for _, rr := range rrs {
+		owner := rr.Header().Name
+		if !dns.IsSubDomain(data.origin, owner) {
+			return nil, errors.Wrap(ErrZoneOutOfZone, owner)
+		}
+		data.records[owner] = append(data.records[owner], rr)
+		data.addReverse(rr)
+		for _, idx := range dns.Split(owner) {
+			data.names[owner[idx:]] = struct{}{}
+			if len(owner[idx:]) == len(data.origin) {
+				break
+			}
+		}
+	}
+	return data, nil
+}
+
+// addReverse indexes the address records, wildcards are skipped.
+func (z *zoneData) addReverse(rr dns.RR) {
+	var addr string
+	switch rr := rr.(type) {
+	case *dns.A:
+		addr = rr.A.String()
+	case *dns.AAAA:
+		addr = rr.AAAA.String()
+	default:
+		return
+	}
+	owner := rr.Header().Name
+	if strings.HasPrefix(owner, "*.") {
+		return
+	}
+	if reverse, err := dns.ReverseAddr(addr); err == nil {
+		z.reverse[reverse] = append(z.reverse[reverse], owner)
+	}
+}
+
+func (z *zoneData) lookup(question dns.Question) *dns.Msg {
+	msg := new(dns.Msg)
+	name := dns.CanonicalName(question.Name)
+	if !dns.IsSubDomain(z.origin, name) {
+		msg.Rcode = dns.RcodeRefused
+		return msg
+	}
+	msg.Authoritative = true
+
+	for range maxCnameChain {
+		if ns := z.delegation(name); ns != nil {
+			if len(msg.Answer) == 0 {
+				msg.Authoritative = false
+			}
+			msg.Ns = ns
+			return msg
+		}
+
+		rrs, found := z.records[name]
+		if !found {
+			if _, exists := z.names[name]; exists {
+				// empty non-terminal
+				msg.Ns = z.negative()
+				return msg
+			}
+			rrs, found = z.wildcard(name)
+			if !found {
+				msg.Rcode = dns.RcodeNameError
+				msg.Ns = z.negative()
+				return msg
+			}
+		}
+
+		var cname *dns.CNAME
+		matched := 0
+		for _, rr := range rrs {
+			rrtype := rr.Header().Rrtype
+			if rrtype == question.Qtype || question.Qtype == dns.TypeANY {
+				msg.Answer = append(msg.Answer, copyRecord(rr, name))
+				matched++
+			} else if c, isCname := rr.(*dns.CNAME); isCname {
+				cname = c
+			}
+		}
+		if matched > 0 {
+			return msg
+		}
+		if cname == nil {
+			msg.Ns = z.negative()
+			return msg
+		}
+
+		msg.Answer = append(msg.Answer, copyRecord(cname, name))
+		name = dns.CanonicalName(cname.Target)
+		if !dns.IsSubDomain(z.origin, name) {
+			// the target is out of zone, let the client chase it
+			return msg
+		}
+	}
+
+	return msg
+}
+
+// delegation returns the NS records of the zone cut above the name, if any.
+func (z *zoneData) delegation(name string) []dns.RR {
+	var cut []dns.RR
+	for _, idx := range dns.Split(name) {
+		ancestor := name[idx:]
+		if len(ancestor) <= len(z.origin) {
+			break
+		}
+		for _, rr := range z.records[ancestor] {
+			if rr.Header().Rrtype == dns.TypeNS {
+				if len(cut) > 0 && cut[0].Header().Name != ancestor {
+					cut = nil
+				}
+				cut = append(cut, dns.Copy(rr))
+			}
+		}
+	}
+	return cut
+}
+
+// wildcard returns the records of the wildcard at the closest encloser of the name.
+func (z *zoneData) wildcard(name string) ([]dns.RR, bool) {
+	for _, idx := range dns.Split(name)[1:] {
+		ancestor := name[idx:]
+		if _, exists := z.names[ancestor]; exists {
+			rrs, found := z.records["*."+ancestor]
+			return rrs, found
+		}
+	}
+	return nil, false
+}
+
+func (z *zoneData) negative() []dns.RR {
+	soa := dns.Copy(z.soa).(*dns.SOA) // nolint:forcetypeassert
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return []dns.RR{soa}
+}
+
+// copyRecord copies the record, so the cache can update its TTL.
+// The owner name is replaced to expand wildcards.
+func copyRecord(rr dns.RR, owner string) dns.RR {
+	cp := dns.Copy(rr)
+	cp.Header().Name = owner
+	return cp
+}
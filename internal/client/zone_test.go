@@ -0,0 +1,31 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+func TestLoadZoneOrigin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "home.lan.zone")
+	zone := "@ 3600 IN SOA ns admin 1 7200 3600 1209600 300\nwww 60 IN A 192.168.1.2\n"
+	if err := os.WriteFile(path, []byte(zone), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := loadZone(path, "home.lan.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := data.lookup(dns.Question{Name: "www.home.lan.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if msg.Rcode != dns.RcodeSuccess || len(msg.Answer) != 1 {
+		t.Fatalf("unexpected answer: %v", msg)
+	}
+
+	if _, err := loadZone(path, ""); !errors.Is(err, ErrZoneOrigin) {
+		t.Fatal("relative names without origin should be rejected")
+	}
+}
@@ -1,40 +1,148 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net/netip"
 	"os"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
 
 type Config struct {
-	Host     string  `json:"host,omitempty"`
-	LogLevel string  `json:"log_level,omitempty"`
-	Rule     []*Rule `json:"rule,omitempty"`
-	Port     int     `json:"port,omitempty"`
+	RuleSet  map[string]*RuleSet `json:"rule_set,omitempty"`
+	Client   map[string][]string `json:"client,omitempty"`
+	Admin    string              `json:"admin,omitempty"`
+	Host     string              `json:"host,omitempty"`
+	CacheDir string              `json:"cache_dir,omitempty"`
+	Geosite  string              `json:"geosite,omitempty"`
+	LogLevel string              `json:"log_level,omitempty"`
+	Match    string              `json:"match,omitempty"`
+	Rule     []*Rule             `json:"rule,omitempty"`
+	View     []*View             `json:"view,omitempty"`
+	Port     int                 `json:"port,omitempty"`
+}
+
+type RuleSet struct {
+	Url     string `json:"url"`
+	Format  string `json:"format"`
+	Proxy   string `json:"proxy,omitempty"`
+	Refresh string `json:"refresh,omitempty"`
+}
+
+// View has its own rules, selected by the listener or the client address.
+type View struct {
+	Name   string   `json:"name"`
+	Client []string `json:"client,omitempty"`
+	Listen []string `json:"listen,omitempty"`
+	Rule   []*Rule  `json:"rule,omitempty"`
 }
 
 type Rule struct {
-	Upstream Upstream `json:"upstream"`
-	Pattern  Pattern  `json:"pattern"`
+	Dns64    *Dns64      `json:"dns64,omitempty"`
+	Schedule []*Schedule `json:"schedule,omitempty"`
+	Pattern  Pattern     `json:"pattern"`
+	Upstream Upstream    `json:"upstream"`
+}
+
+// Schedule is the time when a rule is active.
+type Schedule struct {
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+	Weekday  []string `json:"weekday,omitempty"`
+}
+
+type Dns64 struct {
+	Prefix  string   `json:"prefix,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 type Pattern struct {
-	Builtin      string   `json:"builtin,omitempty"`
-	BuiltinProxy string   `json:"builtin_proxy,omitempty"`
-	Record       string   `json:"record,omitempty"`
-	Domain       []string `json:"domain,omitempty"`
-	Suffix       []string `json:"suffix,omitempty"`
+	Builtin       string     `json:"builtin,omitempty"`
+	BuiltinProxy  string     `json:"builtin_proxy,omitempty"`
+	BuiltinList   []string   `json:"builtin_list,omitempty"`
+	RuleSet       []string   `json:"rule_set,omitempty"`
+	Record        StringList `json:"record,omitempty"`
+	ExcludeRecord []string   `json:"exclude_record,omitempty"`
+	Class         StringList `json:"class,omitempty"`
+	Domain        []string   `json:"domain,omitempty"`
+	Suffix        []string   `json:"suffix,omitempty"`
+	Regex         []string   `json:"regex,omitempty"`
+	Keyword       []string   `json:"keyword,omitempty"`
+	Glob          []string   `json:"glob,omitempty"`
+	ExcludeDomain []string   `json:"exclude_domain,omitempty"`
+	ExcludeSuffix []string   `json:"exclude_suffix,omitempty"`
+	Client        []string   `json:"client,omitempty"`
+	DomainList    []string   `json:"domain_list,omitempty"`
+	DnsmasqList   []string   `json:"dnsmasq_list,omitempty"`
+	Geosite       []string   `json:"geosite,omitempty"`
 }
 
 type Upstream struct {
-	Block    string `json:"block,omitempty"`
+	Block     string `json:"block,omitempty"`
+	BlockIpv4 string `json:"block_ipv4,omitempty"`
+	BlockIpv6 string `json:"block_ipv6,omitempty"`
+
 	Ipv4     string `json:"ipv4,omitempty"`
 	Ipv6     string `json:"ipv6,omitempty"`
 	Udp      string `json:"udp,omitempty"`
 	Doh      string `json:"doh,omitempty"`
 	DohProxy string `json:"doh_proxy,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	Cname    string `json:"cname,omitempty"`
+
+	// set by the router, not configurable
+	EmptyZone  string `json:"-"` // for builtin rules
+	ZoneOrigin string `json:"-"` // for relative names in the zone file
+
+	Hosts    []string `json:"hosts,omitempty"`
+	BlockSoa bool     `json:"block_soa,omitempty"`
+}
+
+// ParseClient parses an IP or a CIDR.
+func ParseClient(client string) (netip.Prefix, bool) {
+	if prefix, err := netip.ParsePrefix(client); err == nil {
+		return prefix.Masked(), true
+	}
+	if addr, err := netip.ParseAddr(client); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// ParseClock parses "15:04" as the duration since midnight, an empty string is midnight.
+func ParseClock(clock string) (time.Duration, bool) {
+	if clock == "" {
+		return 0, true
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+}
+
+// StringList accepts a string or a list of strings.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.WithStack(err)
+	}
+	*l = StringList{s}
+	return nil
 }
 
 func (c *Config) LoadConfigFile(ctx context.Context, file string) {
@@ -46,26 +154,51 @@ func (c *Config) LoadConfigFile(ctx context.Context, file string) {
 
 	logger.Info().Msg("load config")
 
-	f, err := os.Open(file)
-	if err != nil {
+	if err := c.ReadConfigFile(file); err != nil {
 		logger.Error().Stack().Err(err).Send()
 		panic(err)
 	}
-	defer f.Close()
+}
 
-	dec := json.NewDecoder(f)
-	dec.UseNumber()
-	if err := dec.Decode(c); err != nil {
-		logger.Error().Stack().Err(err).Send()
-		panic(err)
+// ReadConfigFile decodes and validates the config file.
+func (c *Config) ReadConfigFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return errors.WithStack(err)
 	}
+	if err := c.Decode(data); err != nil {
+		return err
+	}
+	return c.IsValid()
+}
 
-	if len(c.Rule) > 0 {
-		for _, rule := range c.Rule {
-			if err := rule.IsValid(); err != nil {
-				logger.Error().Stack().Err(err).Send()
-				panic(err)
-			}
+// Decode decodes the config without validation, the error has the position in data.
+func (c *Config) Decode(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(c); err != nil {
+		var offset int64
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		} else if errors.As(err, &typeErr) {
+			offset = typeErr.Offset
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			offset = int64(len(data))
+		} else {
+			return errors.WithStack(err)
 		}
+		line, column := position(data, offset)
+		return errors.WithMessagef(errors.WithStack(err), "line %d, column %d", line, column)
 	}
+	return nil
+}
+
+// position converts the offset to the line and column, starting from 1.
+func position(data []byte, offset int64) (int, int) {
+	data = data[:min(offset, int64(len(data)))]
+	line := bytes.Count(data, []byte("\n")) + 1
+	column := len(data) - bytes.LastIndexByte(data, '\n')
+	return line, column
 }
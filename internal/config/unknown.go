@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UnknownFields returns the JSON paths of fields not in the config, they are ignored by Decode.
+func UnknownFields(data []byte) ([]string, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var fields []string
+	unknownFields(value, reflect.TypeFor[Config](), "", &fields)
+	return fields, nil
+}
+
+func unknownFields(value any, t reflect.Type, path string, fields *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			field, found := jsonField(t, key)
+			if !found {
+				*fields = append(*fields, joinPath(path, key))
+				continue
+			}
+			unknownFields(object[key], field.Type, joinPath(path, key), fields)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			unknownFields(object[key], t.Elem(), joinPath(path, key), fields)
+		}
+	case reflect.Slice:
+		// a StringList may be a string
+		list, ok := value.([]any)
+		if !ok {
+			return
+		}
+		for idx, item := range list {
+			unknownFields(item, t.Elem(), path+"["+strconv.Itoa(idx)+"]", fields)
+		}
+	default: // do nothing
+	}
+}
+
+// jsonField finds the field by its JSON name, case-insensitively like encoding/json.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for idx := range t.NumField() {
+		field := t.Field(idx)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
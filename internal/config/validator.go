@@ -1,60 +1,397 @@
 package config
 
 import (
+	"maps"
 	"net"
 	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 )
 
+// ValidationError is an invalid value of the config.
+type ValidationError struct {
+	Err  error
+	Path string // the JSON path of the value, like "rule[3].upstream.udp"
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validation collects errors, with the path of the value being validated.
+type validation struct {
+	errs *[]*ValidationError
+	path string
+}
+
+func (v validation) field(name string) validation {
+	if v.path != "" {
+		name = v.path + "." + name
+	}
+	return validation{errs: v.errs, path: name}
+}
+
+func (v validation) index(idx int) validation {
+	return validation{errs: v.errs, path: v.path + "[" + strconv.Itoa(idx) + "]"}
+}
+
+func (v validation) report(err error) {
+	*v.errs = append(*v.errs, &ValidationError{Err: err, Path: v.path})
+}
+
+// firstError runs the validate, and returns the first error found.
+func firstError(validate func(validation)) error {
+	var errs []*ValidationError
+	validate(validation{errs: &errs})
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+///
+
+func (c *Config) IsValid() error {
+	return firstError(c.validate)
+}
+
+// Validate returns all errors of the config.
+func (c *Config) Validate() []*ValidationError {
+	var errs []*ValidationError
+	c.validate(validation{errs: &errs})
+	return errs
+}
+
+func (c *Config) validate(v validation) {
+	switch c.Match {
+	case "", "tiered", "longest", "first": // do nothing
+	default:
+		v.field("match").report(errors.Wrap(ErrMatch, c.Match))
+	}
+
+	if c.Admin != "" {
+		if _, _, err := net.SplitHostPort(c.Admin); err != nil {
+			v.field("admin").report(errors.Wrap(ErrAdmin, c.Admin))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Client)) {
+		for idx, client := range c.Client[name] {
+			if _, ok := ParseClient(client); !ok {
+				v.field("client").field(name).index(idx).report(errors.Wrap(ErrClient, client))
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.RuleSet)) {
+		c.RuleSet[name].validate(v.field("rule_set").field(name))
+	}
+
+	c.validateRules(v.field("rule"), c.Rule)
+
+	names := make(map[string]bool)
+	listens := make(map[string]bool)
+	for idx, view := range c.View {
+		vv := v.field("view").index(idx)
+		if view == nil {
+			vv.report(ErrViewName)
+			continue
+		}
+		if view.Name == "" || names[view.Name] {
+			vv.field("name").report(errors.Wrap(ErrViewName, view.Name))
+		}
+		names[view.Name] = true
+		c.validateClients(vv.field("client"), view.Client)
+		for idx, listen := range view.Listen {
+			if _, _, err := net.SplitHostPort(listen); err != nil || listens[listen] {
+				vv.field("listen").index(idx).report(errors.Wrap(ErrViewListen, listen))
+			}
+			listens[listen] = true
+		}
+		c.validateRules(vv.field("rule"), view.Rule)
+	}
+}
+
+func (c *Config) validateRules(v validation, rules []*Rule) {
+	for idx, rule := range rules {
+		rv := v.index(idx)
+		if rule == nil {
+			rv.report(ErrPatternInvalid)
+			continue
+		}
+		rule.validate(rv)
+		for idx, name := range rule.Pattern.RuleSet {
+			if _, found := c.RuleSet[name]; !found {
+				rv.field("pattern").field("rule_set").index(idx).report(errors.Wrap(ErrPatternRuleSet, name))
+			}
+		}
+		c.validateClients(rv.field("pattern").field("client"), rule.Pattern.Client)
+		if len(rule.Pattern.Geosite) > 0 {
+			if _, err := os.Stat(c.Geosite); err != nil {
+				rv.field("pattern").field("geosite").report(errors.Wrap(ErrPatternGeosite, c.Geosite))
+			}
+		}
+	}
+}
+
+// validateClients checks IP, CIDR and client groups.
+func (c *Config) validateClients(v validation, clients []string) {
+	for idx, client := range clients {
+		_, found := c.Client[client]
+		if _, ok := ParseClient(client); !ok && !found {
+			v.index(idx).report(errors.Wrap(ErrPatternClient, client))
+		}
+	}
+}
+
+var (
+	ErrMatch      = errors.New("invalid match policy")
+	ErrAdmin      = errors.New("invalid admin address")
+	ErrViewName   = errors.New("invalid view name")
+	ErrViewListen = errors.New("invalid view listen address")
+)
+
 func (r *Rule) IsValid() error {
+	return firstError(r.validate)
+}
+
+func (r *Rule) validate(v validation) {
 	if r == nil {
-		return nil
+		return
+	}
+	r.Pattern.validate(v.field("pattern"))
+	r.Upstream.validate(v.field("upstream"))
+	if r.Pattern.Builtin == "private-reverse" && r.Upstream.kinds() > 0 {
+		// the upstream is builtin
+		v.field("upstream").report(ErrUpstreamInvalid)
 	}
-	if err := r.Pattern.IsValid(); err != nil {
-		return err
+	if r.Pattern.Builtin == "adblock" && r.Upstream.Block == "" {
+		// the filter list only decides what to block
+		v.field("upstream").field("block").report(ErrUpstreamInvalid)
 	}
-	if err := r.Upstream.IsValid(); err != nil {
-		return err
+	r.Dns64.validate(v.field("dns64"))
+	for idx, schedule := range r.Schedule {
+		schedule.validate(v.field("schedule").index(idx))
 	}
 	// TODO: ipv4 can't use without record A
-	return nil
 }
 
 var (
 	ErrPatternInvalid      = errors.New("invalid pattern")
 	ErrPatternDomain       = errors.New("invalid domain pattern")
 	ErrPatternRecord       = errors.New("invalid record type")
+	ErrPatternClass        = errors.New("invalid record class")
 	ErrPatternBuiltin      = errors.New("invalid builtin rule")
 	ErrPatternBuiltinProxy = errors.New("invalid builtin proxy")
+	ErrPatternBuiltinList  = errors.New("invalid builtin list")
+	ErrPatternRuleSet      = errors.New("undefined rule set")
+	ErrPatternList         = errors.New("invalid domain list")
+	ErrPatternRegex        = errors.New("invalid regex pattern")
+	ErrPatternKeyword      = errors.New("invalid keyword pattern")
+	ErrPatternGlob         = errors.New("invalid glob pattern")
+	ErrPatternGeosite      = errors.New("invalid geosite file")
+	ErrPatternClient       = errors.New("undefined client")
+	ErrClient              = errors.New("invalid client address")
 )
 
 func (pat *Pattern) IsValid() error {
+	return firstError(pat.validate)
+}
+
+func (pat *Pattern) validate(v validation) {
 	if pat == nil {
-		return ErrPatternInvalid
+		v.report(ErrPatternInvalid)
+		return
 	}
 	if pat.Builtin != "" {
 		switch pat.Builtin {
-		case "china-list": // do nothing
+		case "china-list", "private-reverse": // do nothing
+		case "adblock":
+			if len(pat.BuiltinList) == 0 {
+				v.field("builtin_list").report(ErrPatternBuiltinList)
+			}
+			for idx, list := range pat.BuiltinList {
+				if strings.HasPrefix(list, "http://") || strings.HasPrefix(list, "https://") {
+					if _, err := url.Parse(list); err != nil {
+						v.field("builtin_list").index(idx).report(errors.Wrap(ErrPatternBuiltinList, list))
+					}
+				} else if _, err := os.Stat(list); err != nil {
+					v.field("builtin_list").index(idx).report(errors.Wrap(ErrPatternBuiltinList, list))
+				}
+			}
 		default:
-			return errors.Wrap(ErrPatternBuiltin, pat.Builtin)
+			v.field("builtin").report(errors.Wrap(ErrPatternBuiltin, pat.Builtin))
 		}
 		if pat.BuiltinProxy != "" {
 			if _, err := url.Parse(pat.BuiltinProxy); err != nil {
-				return errors.Wrap(ErrPatternBuiltinProxy, pat.BuiltinProxy)
+				v.field("builtin_proxy").report(errors.Wrap(ErrPatternBuiltinProxy, pat.BuiltinProxy))
+			}
+		}
+	} else if len(pat.Domain) == 0 && len(pat.Suffix) == 0 && len(pat.RuleSet) == 0 &&
+		len(pat.Regex) == 0 && len(pat.Keyword) == 0 && len(pat.Glob) == 0 &&
+		len(pat.DomainList) == 0 && len(pat.DnsmasqList) == 0 && len(pat.Geosite) == 0 {
+		v.report(ErrPatternDomain)
+	}
+	for idx, regex := range pat.Regex {
+		if _, err := regexp.Compile(regex); err != nil {
+			v.field("regex").index(idx).report(errors.Wrap(ErrPatternRegex, regex))
+		}
+	}
+	for idx, keyword := range pat.Keyword {
+		if keyword == "" {
+			v.field("keyword").index(idx).report(ErrPatternKeyword)
+		}
+	}
+	for idx, glob := range pat.Glob {
+		if _, err := path.Match(glob, ""); err != nil || strings.Contains(glob, "/") {
+			v.field("glob").index(idx).report(errors.Wrap(ErrPatternGlob, glob))
+		}
+	}
+	for idx, list := range pat.DomainList {
+		if _, err := os.Stat(list); err != nil {
+			v.field("domain_list").index(idx).report(errors.Wrap(ErrPatternList, list))
+		}
+	}
+	for idx, list := range pat.DnsmasqList {
+		if _, err := os.Stat(list); err != nil {
+			v.field("dnsmasq_list").index(idx).report(errors.Wrap(ErrPatternList, list))
+		}
+	}
+	for idx, record := range pat.Record {
+		if _, found := dns.StringToType[record]; !found {
+			v.field("record").index(idx).report(errors.Wrap(ErrPatternRecord, record))
+		}
+	}
+	for idx, record := range pat.ExcludeRecord {
+		if _, found := dns.StringToType[record]; !found || slices.Contains(pat.Record, record) {
+			v.field("exclude_record").index(idx).report(errors.Wrap(ErrPatternRecord, record))
+		}
+	}
+	for idx, class := range pat.Class {
+		if _, found := dns.StringToClass[class]; !found {
+			v.field("class").index(idx).report(errors.Wrap(ErrPatternClass, class))
+		}
+	}
+}
+
+var (
+	ErrRuleSetUrl     = errors.New("invalid rule set URL")
+	ErrRuleSetFormat  = errors.New("invalid rule set format")
+	ErrRuleSetProxy   = errors.New("invalid rule set proxy")
+	ErrRuleSetRefresh = errors.New("invalid rule set refresh interval")
+)
+
+var (
+	ErrScheduleWeekday  = errors.New("invalid schedule weekday")
+	ErrScheduleClock    = errors.New("invalid schedule time")
+	ErrScheduleTimezone = errors.New("invalid schedule timezone")
+)
+
+func (s *Schedule) IsValid() error {
+	return firstError(s.validate)
+}
+
+func (s *Schedule) validate(v validation) {
+	if s == nil {
+		v.report(ErrScheduleClock)
+		return
+	}
+	for idx, day := range s.Weekday {
+		switch strings.ToLower(day) {
+		case "sun", "mon", "tue", "wed", "thu", "fri", "sat",
+			"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday": // do nothing
+		default:
+			v.field("weekday").index(idx).report(errors.Wrap(ErrScheduleWeekday, day))
+		}
+	}
+	if _, ok := ParseClock(s.Start); !ok {
+		v.field("start").report(errors.Wrap(ErrScheduleClock, s.Start))
+	}
+	if _, ok := ParseClock(s.End); !ok {
+		v.field("end").report(errors.Wrap(ErrScheduleClock, s.End))
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			v.field("timezone").report(errors.Wrap(ErrScheduleTimezone, s.Timezone))
+		}
+	}
+}
+
+func (set *RuleSet) IsValid() error {
+	return firstError(set.validate)
+}
+
+func (set *RuleSet) validate(v validation) {
+	if set == nil {
+		v.report(ErrRuleSetUrl)
+		return
+	}
+	if u, err := url.Parse(set.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		v.field("url").report(errors.Wrap(ErrRuleSetUrl, set.Url))
+	}
+	switch set.Format {
+	case "adblock", "dnsmasq", "domain": // do nothing
+	default:
+		v.field("format").report(errors.Wrap(ErrRuleSetFormat, set.Format))
+	}
+	if set.Proxy != "" {
+		if _, err := url.Parse(set.Proxy); err != nil {
+			v.field("proxy").report(errors.Wrap(ErrRuleSetProxy, set.Proxy))
+		}
+	}
+	if set.Refresh != "" {
+		if refresh, err := time.ParseDuration(set.Refresh); err != nil || refresh < time.Minute {
+			v.field("refresh").report(errors.Wrap(ErrRuleSetRefresh, set.Refresh))
+		}
+	}
+}
+
+var (
+	ErrDns64Prefix  = errors.New("invalid DNS64 prefix")
+	ErrDns64Exclude = errors.New("invalid DNS64 exclusion")
+)
+
+func (d *Dns64) IsValid() error {
+	return firstError(d.validate)
+}
+
+func (d *Dns64) validate(v validation) {
+	if d == nil {
+		return
+	}
+	if d.Prefix != "" {
+		ip, prefix, err := net.ParseCIDR(d.Prefix)
+		if err != nil || ip.To4() != nil {
+			v.field("prefix").report(errors.Wrap(ErrDns64Prefix, d.Prefix))
+		} else {
+			// RFC 6052 section 2.2
+			switch size, _ := prefix.Mask.Size(); size {
+			case 32, 40, 48, 56, 64, 96: // do nothing
+			default:
+				v.field("prefix").report(errors.Wrap(ErrDns64Prefix, d.Prefix))
 			}
 		}
-	} else if len(pat.Domain) == 0 && len(pat.Suffix) == 0 {
-		return ErrPatternDomain
 	}
-	if pat.Record != "" {
-		if _, found := dns.StringToType[pat.Record]; !found {
-			return errors.Wrap(ErrPatternRecord, pat.Record)
+	for idx, exclude := range d.Exclude {
+		if _, _, err := net.ParseCIDR(exclude); err != nil {
+			v.field("exclude").index(idx).report(errors.Wrap(ErrDns64Exclude, exclude))
 		}
 	}
-	return nil
 }
 
 var (
@@ -65,56 +402,101 @@ var (
 	ErrUpstreamUdp         = errors.New("invalid UDP")
 	ErrUpstreamDoh         = errors.New("invalid DOH")
 	ErrUpstreamDohProxy    = errors.New("invalid DOH proxy")
+	ErrUpstreamZone        = errors.New("invalid zone file")
+	ErrUpstreamHosts       = errors.New("invalid hosts file")
+	ErrUpstreamCname       = errors.New("invalid CNAME target")
 )
 
 func (up *Upstream) IsValid() error {
+	return firstError(up.validate)
+}
+
+func (up *Upstream) validate(v validation) {
 	if up == nil {
-		return ErrUpstreamInvalid
+		v.report(ErrUpstreamInvalid)
+		return
+	}
+	if up.kinds() > 1 {
+		v.report(ErrUpstreamInvalid)
 	}
 	if up.Block != "" {
-		if up.Block != "nodata" && up.Block != "nxdomain" {
-			return errors.Wrap(ErrUpstreamBlockAction, up.Block)
+		switch up.Block {
+		case "nodata", "nxdomain", "refused", "sinkhole": // do nothing
+		default:
+			v.field("block").report(errors.Wrap(ErrUpstreamBlockAction, up.Block))
 		}
-		if up.Ipv4 != "" || up.Ipv6 != "" || up.Udp != "" || up.Doh != "" || up.DohProxy != "" {
-			return ErrUpstreamInvalid
+	}
+	if up.BlockIpv4 != "" {
+		if net.ParseIP(up.BlockIpv4) == nil || strings.Contains(up.BlockIpv4, ":") {
+			v.field("block_ipv4").report(errors.Wrap(ErrUpstreamIpv4, up.BlockIpv4))
+		} else if up.Block != "sinkhole" {
+			v.field("block_ipv4").report(ErrUpstreamInvalid)
 		}
 	}
+	if up.BlockIpv6 != "" {
+		if net.ParseIP(up.BlockIpv6) == nil || strings.Count(up.BlockIpv6, ":") < 2 {
+			v.field("block_ipv6").report(errors.Wrap(ErrUpstreamIpv6, up.BlockIpv6))
+		} else if up.Block != "sinkhole" {
+			v.field("block_ipv6").report(ErrUpstreamInvalid)
+		}
+	}
+	if up.BlockSoa && up.Block == "" {
+		v.field("block_soa").report(ErrUpstreamInvalid)
+	}
 	if up.Ipv4 != "" {
 		if net.ParseIP(up.Ipv4) == nil || strings.Contains(up.Ipv4, ":") {
-			return errors.Wrap(ErrUpstreamIpv4, up.Ipv4)
-		}
-		if up.Ipv6 != "" || up.Udp != "" || up.Doh != "" || up.DohProxy != "" {
-			return ErrUpstreamInvalid
+			v.field("ipv4").report(errors.Wrap(ErrUpstreamIpv4, up.Ipv4))
 		}
 	}
 	if up.Ipv6 != "" {
 		if net.ParseIP(up.Ipv6) == nil || strings.Count(up.Ipv6, ":") < 2 {
-			return errors.Wrap(ErrUpstreamIpv6, up.Ipv6)
-		}
-		if up.Udp != "" || up.Doh != "" || up.DohProxy != "" {
-			return ErrUpstreamInvalid
+			v.field("ipv6").report(errors.Wrap(ErrUpstreamIpv6, up.Ipv6))
 		}
 	}
 	if up.Udp != "" {
 		if _, _, err := net.SplitHostPort(up.Udp); err != nil {
-			return errors.Wrap(ErrUpstreamUdp, up.Udp)
-		}
-		if up.Doh != "" || up.DohProxy != "" {
-			return ErrUpstreamInvalid
+			v.field("udp").report(errors.Wrap(ErrUpstreamUdp, up.Udp))
 		}
 	}
 	if up.Doh != "" {
 		if _, err := url.Parse(up.Doh); err != nil {
-			return errors.Wrap(ErrUpstreamDoh, up.Doh)
+			v.field("doh").report(errors.Wrap(ErrUpstreamDoh, up.Doh))
 		}
 	}
 	if up.DohProxy != "" {
 		if _, err := url.Parse(up.DohProxy); err != nil {
-			return errors.Wrap(ErrUpstreamDohProxy, up.DohProxy)
+			v.field("doh_proxy").report(errors.Wrap(ErrUpstreamDohProxy, up.DohProxy))
+		} else if up.Doh == "" {
+			v.field("doh_proxy").report(ErrUpstreamInvalid)
+		}
+	}
+	if up.Zone != "" {
+		if _, err := os.Stat(up.Zone); err != nil {
+			v.field("zone").report(errors.Wrap(ErrUpstreamZone, up.Zone))
 		}
-		if up.Doh == "" {
-			return ErrUpstreamInvalid
+	}
+	for idx, hosts := range up.Hosts {
+		if _, err := os.Stat(hosts); err != nil {
+			v.field("hosts").index(idx).report(errors.Wrap(ErrUpstreamHosts, hosts))
 		}
 	}
-	return nil
+	if up.Cname != "" {
+		if _, ok := dns.IsDomainName(up.Cname); !ok {
+			v.field("cname").report(errors.Wrap(ErrUpstreamCname, up.Cname))
+		}
+	}
+}
+
+// kinds returns how many kinds of upstream are configured.
+func (up *Upstream) kinds() int {
+	count := 0
+	for _, kind := range []string{up.Block, up.Ipv4, up.Ipv6, up.Udp, up.Doh, up.Zone, up.Cname} {
+		if kind != "" {
+			count++
+		}
+	}
+	if len(up.Hosts) > 0 {
+		count++
+	}
+	return count
 }
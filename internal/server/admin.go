@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// SetupAdmin serves the admin endpoints, if the admin address is set.
+func (s *DnsServer) SetupAdmin() {
+	if s.Config.Admin == "" {
+		return
+	}
+
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("GET /explain", s.handleExplain)
+	s.adminServer = &http.Server{
+		Handler:           adminMux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(_ net.Listener) context.Context {
+			return s.ctx
+		},
+	}
+	netListener, err := net.Listen("tcp", s.Config.Admin)
+	if err != nil {
+		zerolog.Ctx(s.ctx).
+			Error().
+			Str("module", "server.admin").
+			Stack().
+			Err(err).
+			Send()
+		panic(err)
+	}
+	s.adminListener = netListener
+}
+
+func (s *DnsServer) startAdmin() {
+	if s.adminServer == nil {
+		return
+	}
+
+	zerolog.Ctx(s.ctx).
+		Info().
+		Str("module", "server.admin").
+		Str("admin_addr", "http://"+s.adminListener.Addr().String()+"/").
+		Msg("admin is running")
+
+	err := s.adminServer.Serve(s.adminListener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		zerolog.Ctx(s.ctx).
+			Error().
+			Str("module", "server.admin").
+			Stack().
+			Err(err).
+			Send()
+		panic(err)
+	}
+}
+
+// nolint: contextcheck
+func (s *DnsServer) shutdownAdmin() {
+	if s.adminServer == nil {
+		return
+	}
+	err := s.adminServer.Shutdown(context.Background())
+	if err != nil {
+		zerolog.Ctx(s.ctx).
+			Error().
+			Str("module", "server.admin").
+			Stack().
+			Err(err).
+			Send()
+		panic(err)
+	}
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"flag"
+	"fmt"
+	"os"
 )
 
 func (s *DnsServer) ParseArgs() {
@@ -13,6 +15,7 @@ func (s *DnsServer) ParseArgs() {
 
 	if *configFile != "" {
 		s.Config.LoadConfigFile(s.ctx, *configFile)
+		s.configFile = *configFile
 	}
 
 	if *host != "" {
@@ -33,3 +36,75 @@ func (s *DnsServer) ParseArgs() {
 		s.Config.LogLevel = "info"
 	}
 }
+
+type ExplainArgs struct {
+	Name   string
+	Record string
+	Client string
+	View   string
+}
+
+// ParseExplainArgs parses "godns explain [flags] <name> [type]".
+func (s *DnsServer) ParseExplainArgs(args []string) *ExplainArgs {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	configFile := flags.String("conf", "", "Path to config file.")
+	client := flags.String("client", "", "Client address of the query.")
+	view := flags.String("view", "", "View of the query. (default is selected by the client)")
+	logLevel := flags.String("log-level", "", "Log level. trace, debug, info, warn, error, fatal, panic. (default \"warn\")")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: godns explain [flags] <name> [type]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *configFile != "" {
+		s.Config.LoadConfigFile(s.ctx, *configFile)
+	}
+
+	if *logLevel != "" {
+		s.Config.LogLevel = *logLevel
+	}
+	if s.Config.LogLevel == "" {
+		s.Config.LogLevel = "warn"
+	}
+
+	return &ExplainArgs{
+		Name:   flags.Arg(0),
+		Record: flags.Arg(1),
+		Client: *client,
+		View:   *view,
+	}
+}
+
+type CheckArgs struct {
+	ConfigFile string
+	Strict     bool // warnings fail the check
+}
+
+// ParseCheckArgs parses "godns check --conf file [--strict]".
+func (s *DnsServer) ParseCheckArgs(args []string) *CheckArgs {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	configFile := flags.String("conf", "", "Path to config file.")
+	strict := flags.Bool("strict", false, "Exit with 1 on warnings too.")
+	logLevel := flags.String("log-level", "", "Log level. trace, debug, info, warn, error, fatal, panic. (default \"warn\")")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: godns check --conf file [--strict]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if *configFile == "" || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	s.Config.LogLevel = *logLevel
+	if s.Config.LogLevel == "" {
+		s.Config.LogLevel = "warn"
+	}
+
+	return &CheckArgs{ConfigFile: *configFile, Strict: *strict}
+}
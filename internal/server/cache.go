@@ -12,14 +12,19 @@ import (
 )
 
 type cachedAnswer struct {
-	expired time.Time
-	answer  []dns.RR
+	expired       time.Time
+	answer        []dns.RR
+	ns            []dns.RR
+	ede           []*dns.EDNS0_EDE
+	rcode         int // NOERROR or NXDOMAIN, other errors are not cached
+	authoritative bool
+	stale         bool // set by cacheGet
 }
 type deferredAnswer = util.Deferred[cachedAnswer, int]
 
 ///
 
-func (s *DnsServer) cacheGet(ctx context.Context, key string) ([]dns.RR, *int) {
+func (s *DnsServer) cacheGet(ctx context.Context, key string) (*cachedAnswer, *int) {
 	logger := zerolog.Ctx(ctx).
 		With().
 		Str("module", "server.cache.get").
@@ -39,6 +44,7 @@ func (s *DnsServer) cacheGet(ctx context.Context, key string) ([]dns.RR, *int) {
 		return nil, rcode
 	}
 
+	answer := *cached
 	sec := math.Ceil(time.Until(cached.expired).Seconds())
 	if sec <= 0 {
 		s.cache.Delete(key)
@@ -48,16 +54,29 @@ func (s *DnsServer) cacheGet(ctx context.Context, key string) ([]dns.RR, *int) {
 		// the answer will be considered expired when it added to cache.
 		// Here we set sec=1 to reuse the expired cache.
 		sec = 1
+		answer.stale = len(cached.answer) > 0 || len(cached.ns) > 0
 	}
 	ttl := uint32(sec)
 
-	for idx := range cached.answer {
-		cached.answer[idx].Header().Ttl = ttl
-	}
+	// the cached records are shared by concurrent queries, they are copied before the TTL is changed
+	answer.answer = copyWithTtl(cached.answer, ttl)
+	answer.ns = copyWithTtl(cached.ns, ttl)
 
 	logger.Debug().Uint32("TTL", ttl).Msg("hit")
 
-	return cached.answer, nil
+	return &answer, nil
+}
+
+func copyWithTtl(rrs []dns.RR, ttl uint32) []dns.RR {
+	if len(rrs) == 0 {
+		return rrs
+	}
+	copied := make([]dns.RR, len(rrs))
+	for idx, rr := range rrs {
+		copied[idx] = dns.Copy(rr)
+		copied[idx].Header().Ttl = ttl
+	}
+	return copied
 }
 
 func (s *DnsServer) cacheSet(ctx context.Context, key string, deferred *deferredAnswer) {
@@ -78,7 +97,7 @@ func (s *DnsServer) cacheSet(ctx context.Context, key string, deferred *deferred
 	})
 }
 
-func (s *DnsServer) cacheResolve(ctx context.Context, key string, answer []dns.RR) {
+func (s *DnsServer) cacheResolve(ctx context.Context, key string, msg *dns.Msg) {
 	logger := zerolog.Ctx(ctx).
 		With().
 		Str("module", "server.cache.resolve").
@@ -94,20 +113,34 @@ func (s *DnsServer) cacheResolve(ctx context.Context, key string, answer []dns.R
 	// limit the max ttl to 1 hour
 	maxTtl := uint32(60 * 60)
 	ttl := maxTtl
-	// set ttl to the minimum ttl among all answers
-	for _, ans := range answer {
+	// set ttl to the minimum ttl among all answers and authorities
+	for _, ans := range msg.Answer {
 		currTtl := ans.Header().Ttl
 		if currTtl < ttl {
 			ttl = currTtl
 		}
 	}
-	if len(answer) == 0 {
+	for _, ns := range msg.Ns {
+		currTtl := ns.Header().Ttl
+		if soa, ok := ns.(*dns.SOA); ok {
+			// the negative answer is cached for the minimum of the SOA, RFC 2308 section 5
+			currTtl = min(currTtl, soa.Minttl)
+		}
+		if currTtl < ttl {
+			ttl = currTtl
+		}
+	}
+	if len(msg.Answer) == 0 && len(msg.Ns) == 0 {
 		ttl = 0
 	}
 
 	ans := cachedAnswer{
-		answer:  answer,
-		expired: time.Now().Add(time.Duration(ttl) * time.Second),
+		answer:        msg.Answer,
+		ns:            msg.Ns,
+		ede:           edeOf(msg),
+		rcode:         msg.Rcode,
+		authoritative: msg.Authoritative,
+		expired:       time.Now().Add(time.Duration(ttl) * time.Second),
 	}
 	deferred.Resolve(&ans)
 
@@ -162,6 +195,7 @@ func (s *DnsServer) cleanupExpiredCache() {
 				if rcode != nil {
 					s.cache.Delete(key)
 					logger.Trace().Str("rcode", dns.RcodeToString[*rcode]).Msg("rcode")
+					continue
 				}
 
 				sec := math.Ceil(time.Until(cached.expired).Seconds())
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+// CheckProblem is found in the config by CheckConfig.
+type CheckProblem struct {
+	Path    string // the JSON path, empty for the whole config
+	Message string
+	Warning bool
+}
+
+// RunCheck prints the problems of the config file, and exits with 1 if any error is found.
+// Warnings fail the check too, when it's strict.
+func (s *DnsServer) RunCheck(args *CheckArgs) {
+	problems, err := CheckConfig(s.ctx, args.ConfigFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	WriteProblems(os.Stdout, problems)
+	for _, problem := range problems {
+		if !problem.Warning || args.Strict {
+			os.Exit(1)
+		}
+	}
+}
+
+// CheckConfig validates the config file.
+// It reports all invalid values, unknown fields, and rules shadowed by other rules.
+func CheckConfig(ctx context.Context, file string) ([]CheckProblem, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	conf := new(config.Config)
+	if err := conf.Decode(data); err != nil {
+		return []CheckProblem{{Message: err.Error()}}, nil
+	}
+
+	var problems []CheckProblem
+	invalid := conf.Validate()
+	for _, err := range invalid {
+		problems = append(problems, CheckProblem{Path: err.Path, Message: err.Err.Error()})
+	}
+	fields, err := config.UnknownFields(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		problems = append(problems, CheckProblem{Path: field, Message: "unknown field", Warning: true})
+	}
+	if len(invalid) > 0 {
+		// rules can't be routed with invalid values
+		return problems, nil
+	}
+
+	views, err := newViews(ctx, conf)
+	if err != nil {
+		return append(problems, CheckProblem{Message: err.Error()}), nil
+	}
+	defer views.cancel()
+	problems = append(problems, views.main.router.checkRules(conf.Rule, "rule")...)
+	for idx, view := range views.views {
+		problems = append(problems, view.router.checkRules(conf.View[idx].Rule, fmt.Sprintf("view[%d].rule", idx))...)
+	}
+	return problems, nil
+}
+
+// WriteProblems prints the problems for human.
+func WriteProblems(w io.Writer, problems []CheckProblem) {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	for _, problem := range problems {
+		level := "error  "
+		if problem.Warning {
+			level = "warning"
+		}
+		if problem.Path == "" {
+			fmt.Fprintf(w, "%s %s\n", level, problem.Message)
+		} else {
+			fmt.Fprintf(w, "%s %s: %s\n", level, problem.Path, problem.Message)
+		}
+	}
+}
+
+///
+
+// checkRules finds the domains and suffixes which are always routed to other rules.
+// Other patterns can't be enumerated, they are not checked.
+func (r *router) checkRules(rules []*config.Rule, path string) []CheckProblem {
+	var problems []CheckProblem
+	shadowed := func(idx int, rule *config.Rule, field string, name string, isSuffix bool) bool {
+		by := r.routedTo(idx, rule, name, false)
+		if by == idx {
+			return false
+		}
+		if isSuffix {
+			// any subdomain works, unless all of them are routed by the suffixes of other rules
+			if by = r.routedTo(idx, rule, name, true); by == idx || exceptionUnder(rules, idx, name) {
+				return false
+			}
+		}
+		message := "excluded"
+		if by != -1 {
+			message = fmt.Sprintf("shadowed by %s[%d]", path, by)
+		}
+		problems = append(problems, CheckProblem{Path: fmt.Sprintf("%s[%d].pattern.%s", path, idx, field), Message: message, Warning: true})
+		return true
+	}
+
+	for idx, rule := range rules {
+		pat := &rule.Pattern
+		count := 0
+		for i, domain := range pat.Domain {
+			if shadowed(idx, rule, fmt.Sprintf("domain[%d]", i), domain, false) {
+				count++
+			}
+		}
+		for i, suffix := range pat.Suffix {
+			if shadowed(idx, rule, fmt.Sprintf("suffix[%d]", i), suffix, true) {
+				count++
+			}
+		}
+
+		literal := pat.Builtin == "" && len(pat.RuleSet) == 0 && len(pat.Regex) == 0 && len(pat.Keyword) == 0 &&
+			len(pat.Glob) == 0 && len(pat.DomainList) == 0 && len(pat.DnsmasqList) == 0 && len(pat.Geosite) == 0
+		if literal && count > 0 && count == len(pat.Domain)+len(pat.Suffix) {
+			problems = append(problems, CheckProblem{
+				Path:    fmt.Sprintf("%s[%d]", path, idx),
+				Message: "unreachable, no pattern is used",
+				Warning: true,
+			})
+		}
+	}
+	return problems
+}
+
+// routedTo returns the rule used for the name, by a query which the rule matches.
+// It's the rule itself if the result depends on the query, or -1 if no rule is used.
+// With subdomains, only the suffixes covering all subdomains of the name are compared.
+func (r *router) routedTo(priority int, rule *config.Rule, name string, subdomains bool) int {
+	name = strings.TrimSuffix(dns.CanonicalName(name), ".")
+	var cs routerCandidates
+	if subdomains {
+		r.collectSuffixes(name, &cs)
+	} else {
+		r.collect(name, &cs)
+	}
+
+	var m *routerMatched
+	for _, candidates := range [][]routerCandidate{cs.domainWithRecord, cs.domain, cs.domainSuffixWithRecord, cs.domainSuffix} {
+		for _, c := range candidates {
+			if c.matched.rule == rule && !c.matched.allow {
+				m = c.matched
+			}
+		}
+	}
+	if m == nil {
+		return priority
+	}
+
+	question := dns.Question{Name: dns.Fqdn(name), Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if len(m.records) > 0 {
+		question.Qtype = m.records[0]
+	} else {
+		for _, record := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeHTTPS, dns.TypeTXT} {
+			if !slices.Contains(m.excludeRecords, record) {
+				question.Qtype = record
+				break
+			}
+		}
+	}
+	if len(m.classes) > 0 {
+		question.Qclass = m.classes[0]
+	}
+	var client netip.Addr
+	if len(m.clients) > 0 {
+		client = m.clients[0].Addr()
+	}
+	now, _ := m.activeTime(time.Now())
+
+	tiers, best, _ := r.pick(&cs, question, client, now)
+	if best == -1 {
+		return -1
+	}
+	picked := tiers[best].picked.matched
+	if picked.priority == priority || !picked.unconditional() {
+		return priority
+	}
+	return picked.priority
+}
+
+// exceptionUnder reports whether other rules exclude some subdomains of the suffix,
+// then these subdomains may be routed to the rule.
+func exceptionUnder(rules []*config.Rule, priority int, suffix string) bool {
+	suffix = strings.TrimSuffix(dns.CanonicalName(suffix), ".")
+	for idx, rule := range rules {
+		if idx == priority {
+			continue
+		}
+		for _, name := range slices.Concat(rule.Pattern.ExcludeDomain, rule.Pattern.ExcludeSuffix) {
+			name = strings.TrimSuffix(dns.CanonicalName(name), ".")
+			if name != suffix && (suffix == "" || strings.HasSuffix(name, "."+suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectSuffixes adds the candidates of suffixes only.
+// Domains and other patterns don't match all subdomains of the name, so they are skipped.
+func (r *router) collectSuffixes(name string, cs *routerCandidates) {
+	r.domainSuffix.collect(name, true, cs.addSuffix)
+	for _, ruleSet := range r.ruleSets {
+		if data := ruleSet.data.Load(); data != nil {
+			data.collectSuffixes(name, cs)
+		}
+	}
+}
+
+// unconditional reports whether the rule matches all queries of its domains.
+func (m *routerMatched) unconditional() bool {
+	return len(m.records) == 0 && len(m.excludeRecords) == 0 && len(m.classes) == 0 &&
+		len(m.clients) == 0 && len(m.schedules) == 0
+}
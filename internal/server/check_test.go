@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		config   string
+		problems []CheckProblem
+	}{
+		{
+			`{ "rule": [ { "pattern": { "suffix": ["."] }, "upstream": { "udp": "1.1.1.1:53" } } ] }`,
+			nil,
+		},
+		{
+			`{ "rule": [ { "pattern": { "suffix": ["."] } ] `,
+			[]CheckProblem{{Path: "", Message: "line 1, column 47: invalid character ']' after object key:value pair"}},
+		},
+		{
+			`{ "rule": [
+				{ "pattern": { "suffix": ["."] }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "suffix": ["cn"] }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "domain": ["a.cn"] }, "upstream": { "ipv4": "192.0.2.1" } },
+				{ "pattern": { "domian": ["b.cn"], "domain": ["b.cn"] }, "upstream": { "udp": "bad" } }
+			] }`,
+			[]CheckProblem{
+				{Path: "rule[3].upstream.udp", Message: "bad: invalid UDP"},
+				{Path: "rule[3].pattern.domian", Message: "unknown field", Warning: true},
+			},
+		},
+		{
+			`{ "match": "first", "rule": [
+				{ "pattern": { "suffix": ["."], "exclude_suffix": ["a.example.org"] }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "suffix": ["example.com"] }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "suffix": ["example.org"] }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "domain": ["example.net"], "suffix": ["example.net"] }, "upstream": { "udp": "1.1.1.1:53" } }
+			] }`,
+			[]CheckProblem{
+				{Path: "rule[1].pattern.suffix[0]", Message: "shadowed by rule[0]", Warning: true},
+				{Path: "rule[1]", Message: "unreachable, no pattern is used", Warning: true},
+				{Path: "rule[3].pattern.domain[0]", Message: "shadowed by rule[0]", Warning: true},
+				{Path: "rule[3].pattern.suffix[0]", Message: "shadowed by rule[0]", Warning: true},
+				{Path: "rule[3]", Message: "unreachable, no pattern is used", Warning: true},
+			},
+		},
+		{
+			`{ "rule": [
+				{ "pattern": { "domain": ["example.com"] }, "upstream": { "ipv4": "192.0.2.1" } },
+				{ "pattern": { "suffix": ["example.com"] }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "suffix": ["example.com"], "record": "A" }, "upstream": { "udp": "1.1.1.1:53" } },
+				{ "pattern": { "suffix": ["example.com"], "exclude_domain": ["a.example.com"] }, "upstream": { "udp": "1.1.1.1:53" } }
+			] }`,
+			[]CheckProblem{
+				{Path: "rule[3].pattern.suffix[0]", Message: "shadowed by rule[1]", Warning: true},
+				{Path: "rule[3]", Message: "unreachable, no pattern is used", Warning: true},
+			},
+		},
+		{
+			`{ "view": [ { "name": "lan", "rule": [
+				{ "pattern": { "domain": ["x.lan"] }, "upstream": { "ipv4": "192.0.2.1" } },
+				{ "pattern": { "domain": ["x.lan"] }, "upstream": { "ipv4": "192.0.2.2" } }
+			] } ] }`,
+			[]CheckProblem{
+				{Path: "view[0].rule[1].pattern.domain[0]", Message: "shadowed by view[0].rule[0]", Warning: true},
+				{Path: "view[0].rule[1]", Message: "unreachable, no pattern is used", Warning: true},
+			},
+		},
+	}
+	for idx, tt := range tests {
+		file := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(file, []byte(tt.config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		problems, err := CheckConfig(context.Background(), file)
+		if err != nil {
+			t.Errorf("%d: %v", idx, err)
+			continue
+		}
+		if !slices.Equal(problems, tt.problems) {
+			t.Errorf("%d: got %+v, want %+v", idx, problems, tt.problems)
+		}
+	}
+}
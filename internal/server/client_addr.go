@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/netip"
+)
+
+type clientAddrKey struct{}
+
+func withClientAddr(ctx context.Context, remote net.Addr) context.Context {
+	var addrPort netip.AddrPort
+	switch addr := remote.(type) {
+	case *net.UDPAddr:
+		addrPort = addr.AddrPort()
+	case *net.TCPAddr:
+		addrPort = addr.AddrPort()
+	default:
+		return ctx
+	}
+	return withClientIp(ctx, addrPort.Addr().Unmap())
+}
+
+func withClientIp(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+// clientAddrOf returns the address of the client, it's invalid if unknown.
+func clientAddrOf(ctx context.Context) netip.Addr {
+	addr, _ := ctx.Value(clientAddrKey{}).(netip.Addr)
+	return addr
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/client"
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+// the well-known prefix, RFC 6052 section 2.1
+const dns64DefaultPrefix = "64:ff9b::/96"
+
+// AAAA records in these ranges are treated as nonexistent, RFC 6147 section 5.1.4
+var dns64DefaultExclude = []string{"::ffff:0:0/96"}
+
+// dns64Networks is parsed from the config once, when the rule is added.
+type dns64Networks struct {
+	prefix   *net.IPNet
+	exclude6 []*net.IPNet
+	exclude4 []*net.IPNet
+}
+
+type checkingDisabledKey struct{}
+
+// withCheckingDisabled marks the request with the CD bit, DNS64 is skipped for it, RFC 6147 section 5.5.
+func withCheckingDisabled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, checkingDisabledKey{}, true)
+}
+
+func checkingDisabledOf(ctx context.Context) bool {
+	cd, _ := ctx.Value(checkingDisabledKey{}).(bool)
+	return cd
+}
+
+// dns64 synthesizes AAAA records from A records, when the AAAA query returns no data.
+// The flags and the authority section of the AAAA reply are kept.
+func (s *DnsServer) dns64(
+	ctx context.Context,
+	resolver client.DnsResolver,
+	question dns.Question,
+	dnssec bool,
+	networks *dns64Networks,
+	msg *dns.Msg,
+) *dns.Msg {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "server.dns64").
+		Str("domain", question.Name).
+		Logger()
+
+	if msg.Rcode != dns.RcodeSuccess {
+		return msg
+	}
+	if checkingDisabledOf(ctx) {
+		logger.Trace().Msg("checking disabled")
+		return msg
+	}
+
+	answer := make([]dns.RR, 0, len(msg.Answer))
+	found := false
+	for _, rr := range msg.Answer {
+		if aaaa, ok := rr.(*dns.AAAA); ok {
+			if containsIp(networks.exclude6, aaaa.AAAA) {
+				continue
+			}
+			found = true
+		}
+		answer = append(answer, rr)
+	}
+	if found {
+		msg.Answer = answer
+		return msg
+	}
+
+	aQuestion := question
+	aQuestion.Qtype = dns.TypeA
+	aMsg, err := resolver.Resolve(ctx, aQuestion, dnssec)
+	if err != nil || aMsg.Rcode != dns.RcodeSuccess {
+		logger.Debug().Err(err).Msg("failed to query A")
+		return msg
+	}
+
+	synthesized := make([]dns.RR, 0, len(aMsg.Answer))
+	for _, rr := range aMsg.Answer {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			synthesized = append(synthesized, rr)
+			continue
+		}
+		if containsIp(networks.exclude4, a.A) {
+			continue
+		}
+		aaaa := new(dns.AAAA)
+		aaaa.Hdr = dns.RR_Header{Name: a.Hdr.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: a.Hdr.Ttl}
+		aaaa.AAAA = embedIpv4(networks.prefix, a.A)
+		synthesized = append(synthesized, aaaa)
+		found = true
+	}
+	if !found {
+		return msg
+	}
+
+	logger.Debug().Msg("synthesized")
+	msg.Answer = synthesized
+	return msg
+}
+
+func parseDns64(conf *config.Dns64) *dns64Networks {
+	if conf == nil {
+		return nil
+	}
+
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = dns64DefaultPrefix
+	}
+	_, prefixNet, _ := net.ParseCIDR(prefix)
+
+	networks := &dns64Networks{prefix: prefixNet}
+	for _, exclude := range slices.Concat(dns64DefaultExclude, conf.Exclude) {
+		_, excludeNet, err := net.ParseCIDR(exclude)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(exclude, ":") {
+			networks.exclude6 = append(networks.exclude6, excludeNet)
+		} else {
+			networks.exclude4 = append(networks.exclude4, excludeNet)
+		}
+	}
+	return networks
+}
+
+func containsIp(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// embedIpv4 follows RFC 6052 section 2.2, bits 64 to 71 are skipped.
+func embedIpv4(prefix *net.IPNet, ip net.IP) net.IP {
+	embedded := make(net.IP, net.IPv6len)
+	copy(embedded, prefix.IP.To16())
+	size, _ := prefix.Mask.Size()
+	pos := size / 8
+	for _, b := range ip.To4() {
+		if pos == 8 {
+			pos++
+		}
+		embedded[pos] = b
+		pos++
+	}
+	return embedded
+}
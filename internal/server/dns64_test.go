@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+func TestEmbedIpv4(t *testing.T) {
+	// RFC 6052 section 2.4
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::/96", "64:ff9b::192.0.2.33"},
+	}
+	for _, tt := range tests {
+		_, prefix, err := net.ParseCIDR(tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := embedIpv4(prefix, net.ParseIP("192.0.2.33"))
+		if !got.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("%s: got %s, want %s", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+type testResolver map[uint16]*dns.Msg
+
+func (r testResolver) Resolve(ctx context.Context, question dns.Question, dnssec bool) (*dns.Msg, error) {
+	return r[question.Qtype].Copy(), nil
+}
+
+func TestDns64(t *testing.T) {
+	networks := parseDns64(&config.Dns64{Exclude: []string{"10.0.0.0/8", "2001:db8::/32"}})
+	question := dns.Question{Name: "example.com.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET}
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	soa := rr("example.com. 300 IN SOA ns admin 1 3600 600 86400 60")
+	a := new(dns.Msg)
+	a.Answer = []dns.RR{rr("example.com. 60 IN A 10.0.0.1"), rr("example.com. 60 IN A 192.0.2.1")}
+
+	tests := []struct {
+		name string
+		aaaa []dns.RR
+		want []string
+		cd   bool
+		keep bool // the synthesized reply keeps the flags and the authority section
+	}{
+		{"native", []dns.RR{rr("example.com. 60 IN AAAA 2001:db9::1")}, []string{"2001:db9::1"}, false, false},
+		{"no data", nil, []string{"64:ff9b::c000:201"}, false, true},
+		{"checking disabled", nil, nil, true, true},
+		// the excluded AAAA records are treated as nonexistent
+		{"excluded ipv6", []dns.RR{rr("example.com. 60 IN AAAA 2001:db8::1")}, []string{"64:ff9b::c000:201"}, false, true},
+		{"mapped ipv4", []dns.RR{rr("example.com. 60 IN AAAA ::ffff:192.0.2.1")}, []string{"64:ff9b::c000:201"}, false, true},
+	}
+	for _, tt := range tests {
+		aaaa := new(dns.Msg)
+		aaaa.Authoritative = true
+		aaaa.Answer = tt.aaaa
+		if tt.aaaa == nil {
+			aaaa.Ns = []dns.RR{soa}
+		}
+		ctx := context.Background()
+		if tt.cd {
+			ctx = withCheckingDisabled(ctx)
+		}
+		resolver := testResolver{dns.TypeAAAA: aaaa, dns.TypeA: a}
+		msg := (&DnsServer{}).dns64(ctx, resolver, question, false, networks, aaaa.Copy())
+
+		var got []string
+		for _, r := range msg.Answer {
+			if r, ok := r.(*dns.AAAA); ok {
+				got = append(got, r.AAAA.String())
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for idx := range got {
+			if !net.ParseIP(got[idx]).Equal(net.ParseIP(tt.want[idx])) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		}
+		if tt.keep && (!msg.Authoritative || len(msg.Ns) != len(aaaa.Ns)) {
+			t.Errorf("%s: authoritative %v, authority %v", tt.name, msg.Authoritative, msg.Ns)
+		}
+	}
+}
+
+func TestDns64Exclude(t *testing.T) {
+	networks := parseDns64(&config.Dns64{Exclude: []string{"10.0.0.0/8", "2001:db8::/32"}})
+	tests := []struct {
+		nets     []*net.IPNet
+		ip       string
+		excluded bool
+	}{
+		{networks.exclude6, "::ffff:192.0.2.1", true}, // the default exclusion
+		{networks.exclude6, "2001:db8::1", true},
+		{networks.exclude6, "2001:db9::1", false},
+		{networks.exclude4, "10.1.2.3", true},
+		{networks.exclude4, "192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		if got := containsIp(tt.nets, net.ParseIP(tt.ip)); got != tt.excluded {
+			t.Errorf("%s: got %v, want %v", tt.ip, got, tt.excluded)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// addEde attaches an extended DNS error (RFC 8914) to the msg.
+func addEde(msg *dns.Msg, ede *dns.EDNS0_EDE) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(4096, false)
+		opt = msg.IsEdns0()
+	}
+	opt.Option = append(opt.Option, ede)
+}
+
+// blockedEde names the rule blocking the question.
+func blockedEde(matched *routerMatched) *dns.EDNS0_EDE {
+	return &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked, ExtraText: fmt.Sprintf("blocked by rule %d", matched.priority)}
+}
+
+// edeOf returns the extended DNS errors attached to the msg.
+func edeOf(msg *dns.Msg) []*dns.EDNS0_EDE {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	var edes []*dns.EDNS0_EDE
+	for _, option := range opt.Option {
+		if ede, ok := option.(*dns.EDNS0_EDE); ok {
+			edes = append(edes, ede)
+		}
+	}
+	return edes
+}
+
+// replyEde attaches extended DNS errors to the reply, if the client supports EDNS.
+func replyEde(reply *dns.Msg, edes ...*dns.EDNS0_EDE) {
+	opt := reply.IsEdns0()
+	if opt == nil {
+		return
+	}
+	for _, ede := range edes {
+		opt.Option = append(opt.Option, ede)
+	}
+}
+
+// edeOfError returns the extended DNS error for a failed upstream.
+func edeOfError(err error) *dns.EDNS0_EDE {
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return nil
+	}
+	if netErr.Timeout() {
+		return &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNoReachableAuthority, ExtraText: err.Error()}
+	}
+	return &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNetworkError, ExtraText: err.Error()}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+var (
+	errExplainType   = errors.New("invalid record type")
+	errExplainClient = errors.New("invalid client address")
+	errExplainView   = errors.New("undefined view")
+)
+
+// Explanation shows how a query is routed.
+type Explanation struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Client   string          `json:"client,omitempty"`
+	View     string          `json:"view,omitempty"`
+	Matched  *ExplainedRule  `json:"matched"`
+	Shadowed []ExplainedRule `json:"shadowed,omitempty"`
+}
+
+type ExplainedRule struct {
+	Pattern  *config.Pattern  `json:"pattern"`
+	Upstream *config.Upstream `json:"upstream"`
+	Kind     string           `json:"kind"`             // domain, suffix, regex, keyword or glob, with "+record" for rules with record
+	Reason   string           `json:"reason,omitempty"` // why the rule is not used
+	Rule     int              `json:"rule"`
+}
+
+// RunExplain prints how the query is routed, with the cached rule sets.
+func (s *DnsServer) RunExplain(args *ExplainArgs) {
+	s.SetupRouter()
+	s.views.Load().loadRuleSets(nil)
+
+	explanation, err := s.Explain(s.ctx, args.Name, args.Record, args.Client, args.View)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	explanation.WriteText(os.Stdout)
+}
+
+// Explain routes the query like the DNS server, the client and the view are optional.
+func (s *DnsServer) Explain(ctx context.Context, name string, record string, client string, viewName string) (*Explanation, error) {
+	if record == "" {
+		record = "A"
+	}
+	qtype, found := dns.StringToType[strings.ToUpper(record)]
+	if !found {
+		return nil, errors.Wrap(errExplainType, record)
+	}
+	question := dns.Question{Name: dns.Fqdn(name), Qtype: qtype, Qclass: dns.ClassINET}
+
+	if client != "" {
+		addr, err := netip.ParseAddr(client)
+		if err != nil {
+			return nil, errors.Wrap(errExplainClient, client)
+		}
+		ctx = withClientIp(ctx, addr.Unmap())
+	}
+
+	views := s.views.Load()
+	view := views.selectView(ctx, "")
+	if viewName != "" {
+		idx := slices.IndexFunc(views.views, func(v *dnsView) bool { return v.name == viewName })
+		if idx == -1 {
+			return nil, errors.Wrap(errExplainView, viewName)
+		}
+		view = views.views[idx]
+	}
+
+	explanation := view.router.explain(ctx, question)
+	explanation.Client = client
+	explanation.View = view.name
+	return explanation, nil
+}
+
+func (r *router) explain(ctx context.Context, question dns.Question) *Explanation {
+	name := strings.TrimSuffix(dns.CanonicalName(question.Name), ".")
+	client := clientAddrOf(ctx)
+	now := time.Now()
+
+	var cs routerCandidates
+	r.collect(name, &cs)
+	tiers, best, excluded := r.pick(&cs, question, client, now)
+
+	explanation := &Explanation{
+		Name: question.Name,
+		Type: dns.TypeToString[question.Qtype],
+	}
+	var picked *routerCandidate
+	if best != -1 {
+		picked = tiers[best].picked
+		explanation.Matched = explainRule(picked.matched, candidateKind(&tiers[best], picked), "")
+	}
+
+	// the same rule may be collected many times, only the first is shown
+	seen := make(map[int]bool)
+	if picked != nil {
+		seen[picked.matched.priority] = true
+	}
+	for idx := range tiers {
+		tier := &tiers[idx]
+		for _, c := range tier.candidates {
+			if c.matched.allow || seen[c.matched.priority] {
+				continue
+			}
+			seen[c.matched.priority] = true
+
+			reason := c.matched.mismatch(question, client, now)
+			if reason == "" && slices.Contains(excluded, c.matched.priority) {
+				reason = "excluded"
+			}
+			if reason == "" {
+				reason = r.shadowedReason(&tiers, best, idx, c)
+			}
+			explanation.Shadowed = append(explanation.Shadowed, *explainRule(c.matched, candidateKind(tier, &c), reason))
+		}
+	}
+	slices.SortFunc(explanation.Shadowed, func(a, b ExplainedRule) int { return a.Rule - b.Rule })
+	return explanation
+}
+
+// shadowedReason tells why a matched candidate loses to the picked one.
+func (r *router) shadowedReason(tiers *[4]routerTier, best int, idx int, c routerCandidate) string {
+	if r.firstMatch {
+		return "defined later"
+	}
+	if !tiers[best].suffix || !tiers[idx].suffix {
+		if idx == best {
+			return "defined later"
+		}
+		return "less specific"
+	}
+	picked := tiers[best].picked
+	if !r.longestMatch && idx != best {
+		// the picked of suffix tiers are compared by priority
+		if tiers[idx].picked.matched == c.matched {
+			return "defined later"
+		}
+		picked = tiers[idx].picked
+	}
+	// a rule defined earlier only loses to a deeper one, which may lose to a regex or keyword
+	if c.matched.priority < picked.matched.priority ||
+		(c.depth != patternDepth && picked.depth != patternDepth && c.depth < picked.depth) {
+		return "less specific"
+	}
+	return "defined later"
+}
+
+func explainRule(matched *routerMatched, kind string, reason string) *ExplainedRule {
+	return &ExplainedRule{
+		Rule:     matched.priority,
+		Kind:     kind,
+		Reason:   reason,
+		Pattern:  &matched.rule.Pattern,
+		Upstream: &matched.rule.Upstream,
+	}
+}
+
+func candidateKind(tier *routerTier, c *routerCandidate) string {
+	kind := "domain"
+	if c.pattern != "" {
+		kind = c.pattern
+	} else if tier.suffix {
+		kind = "suffix"
+	}
+	if tier.record {
+		kind += "+record"
+	}
+	return kind
+}
+
+// mismatch returns why the rule doesn't match the question.
+func (m *routerMatched) mismatch(question dns.Question, client netip.Addr, now time.Time) string {
+	if len(m.records) > 0 && !slices.Contains(m.records, question.Qtype) || slices.Contains(m.excludeRecords, question.Qtype) {
+		return "record not matched"
+	}
+	if len(m.classes) > 0 && !slices.Contains(m.classes, question.Qclass) {
+		return "class not matched"
+	}
+	if len(m.clients) > 0 && !containsClient(m.clients, client) {
+		return "client not matched"
+	}
+	if !m.matchSchedule(now) {
+		return "schedule inactive"
+	}
+	return ""
+}
+
+///
+
+// WriteText prints the explanation for human.
+func (e *Explanation) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "query    %s %s", e.Name, e.Type)
+	if e.Client != "" {
+		fmt.Fprintf(w, ", client %s", e.Client)
+	}
+	if e.View != "" {
+		fmt.Fprintf(w, ", view %s", e.View)
+	}
+	fmt.Fprintln(w)
+
+	if e.Matched == nil {
+		fmt.Fprintln(w, "matched  none, the query is refused with NOTIMP")
+	} else {
+		fmt.Fprintf(w, "matched  rule %d, %s\n", e.Matched.Rule, e.Matched.Kind)
+		fmt.Fprintf(w, "pattern  %s\n", toJson(e.Matched.Pattern))
+		fmt.Fprintf(w, "upstream %s\n", toJson(e.Matched.Upstream))
+	}
+
+	if len(e.Shadowed) > 0 {
+		fmt.Fprintln(w, "shadowed")
+		for _, rule := range e.Shadowed {
+			fmt.Fprintf(w, "  rule %d, %s, %s\n", rule.Rule, rule.Kind, rule.Reason)
+			fmt.Fprintf(w, "    pattern  %s\n", toJson(rule.Pattern))
+			fmt.Fprintf(w, "    upstream %s\n", toJson(rule.Upstream))
+		}
+	}
+}
+
+func toJson(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// handleExplain serves "/explain?name=example.com&type=A&client=192.168.1.2&view=office"
+func (s *DnsServer) handleExplain(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("name") == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	explanation, err := s.Explain(req.Context(), query.Get("name"), query.Get("type"), query.Get("client"), query.Get("view"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(explanation)
+}
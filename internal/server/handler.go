@@ -2,22 +2,34 @@ package server
 
 import (
 	"context"
-	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/dhcmrlchtdj/godns/internal/client"
 	"github.com/dhcmrlchtdj/godns/internal/util"
 )
 
-func (s *DnsServer) handleRequest(w dns.ResponseWriter, request *dns.Msg) {
+var (
+	errNoUpstream = errors.New("no upstream")
+	errNoResolver = errors.New("no resolver")
+	errAliasLoop  = errors.New("alias loop")
+)
+
+// the max length of a chain of cname rules
+const maxAliasChain = 8
+
+// handleRequest answers the request, the listen is the address of the view listener.
+func (s *DnsServer) handleRequest(w dns.ResponseWriter, request *dns.Msg, listen string) {
 	loggerWithId := zerolog.Ctx(s.ctx).
 		With().
 		Uint16("request_id", request.Id).
 		Logger()
-	ctx := loggerWithId.WithContext(s.ctx)
+	ctx := withClientAddr(loggerWithId.WithContext(s.ctx), w.RemoteAddr())
 
 	logger := loggerWithId.
 		With().
@@ -36,7 +48,7 @@ func (s *DnsServer) handleRequest(w dns.ResponseWriter, request *dns.Msg) {
 		Str("opcode", dns.OpcodeToString[request.Opcode]).
 		Msg("receive request")
 	if request.Opcode == dns.OpcodeQuery {
-		s.query(ctx, reply)
+		s.query(ctx, s.views.Load().selectView(ctx, listen), reply)
 	} else {
 		reply.Rcode = dns.RcodeNotImplemented
 	}
@@ -50,7 +62,7 @@ func (s *DnsServer) handleRequest(w dns.ResponseWriter, request *dns.Msg) {
 	logger.Trace().Dur("latency", latency).Send()
 }
 
-func (s *DnsServer) query(ctx context.Context, reply *dns.Msg) {
+func (s *DnsServer) query(ctx context.Context, view *dnsView, reply *dns.Msg) {
 	logger := zerolog.Ctx(ctx).
 		With().
 		Str("module", "server.handler").
@@ -65,21 +77,56 @@ func (s *DnsServer) query(ctx context.Context, reply *dns.Msg) {
 	}
 
 	question := reply.Question[0]
+	clientAddr := clientAddrOf(ctx)
 	logger.Info().
 		Str("name", question.Name).
 		Str("record", dns.TypeToString[question.Qtype]).
 		Bool("dnssec", reply.IsEdns0() != nil).
+		Stringer("client", clientAddr).
+		Str("view", view.name).
 		Msg("query")
 
-	// from cache
-	cacheKey := question.String()
-	answer, rcode := s.cacheGet(ctx, cacheKey)
+	// from local records
+	if question.Qtype == dns.TypePTR {
+		if answer := view.reverse.lookup(ctx, question); answer != nil {
+			reply.Answer = answer
+			reply.Authoritative = true
+			logger.Trace().Msg("from local records")
+			return
+		}
+	}
+
+	matched := view.router.search(ctx, question)
+	if matched == nil {
+		logger.Trace().Msg("no upstream")
+		reply.Rcode = dns.RcodeNotImplemented
+		return
+	}
+	if matched.rule.Upstream.Block != "" {
+		// the answer is shared by the rules with the same route, the rule is added to each reply
+		defer replyEde(reply, blockedEde(matched))
+	}
+
+	// from cache, questions with the same route in the same view share the answer
+	cacheKey := question.String() + " " + matched.route + " view:" + view.name
+	if reply.CheckingDisabled {
+		ctx = withCheckingDisabled(ctx)
+		cacheKey += " cd"
+	}
+	cached, rcode := s.cacheGet(ctx, cacheKey)
 	if rcode != nil {
 		reply.Rcode = *rcode
 		logger.Trace().Msg("from cache")
 		return
-	} else if answer != nil {
-		reply.Answer = answer
+	} else if cached != nil {
+		reply.Rcode = cached.rcode
+		reply.Answer = cached.answer
+		reply.Ns = cached.ns
+		reply.Authoritative = cached.authoritative
+		replyEde(reply, cached.ede...)
+		if cached.stale {
+			replyEde(reply, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer})
+		}
 		logger.Trace().Msg("from cache")
 		return
 	}
@@ -87,41 +134,133 @@ func (s *DnsServer) query(ctx context.Context, reply *dns.Msg) {
 	deferred := util.MakeDeferred[cachedAnswer, int]()
 	s.cacheSet(ctx, cacheKey, deferred)
 
-	upstream := s.router.search(ctx, question.Name, question.Qtype)
-
-	// no upstream
-	if upstream == nil {
-		logger.Trace().Msg("no upstream")
-		reply.Rcode = dns.RcodeNotImplemented
-		s.cacheReject(ctx, cacheKey, reply.Rcode)
-		return
-	}
-	// no resolver
-	resolver := client.GetByUpstream(ctx, upstream)
-	if resolver == nil {
-		logger.Error().Msg("no resolver")
-		reply.Rcode = dns.RcodeNotImplemented
-		s.cacheReject(ctx, cacheKey, reply.Rcode)
-		return
-	}
-
 	// from upstream
-	ans, err := resolver.Resolve(ctx, question, reply.IsEdns0() != nil)
-	if err == nil {
-		reply.Answer = ans
-		logger.Trace().Msg("resolved")
-		s.cacheResolve(ctx, cacheKey, ans)
-	} else {
-		var errRcode *client.ErrDnsResponse
-		if errors.As(err, &errRcode) {
-			reply.Rcode = errRcode.Rcode
-			logger.Debug().
-				Str("Rcode", dns.RcodeToString[reply.Rcode]).
-				Msg("resolved")
+	msg, err := s.resolveMatched(ctx, view, question, reply.IsEdns0() != nil, matched, nil)
+	if err != nil {
+		if errors.Is(err, errNoUpstream) {
+			logger.Trace().Msg("no upstream")
+			reply.Rcode = dns.RcodeNotImplemented
+		} else if errors.Is(err, errNoResolver) {
+			logger.Error().Msg("no resolver")
+			reply.Rcode = dns.RcodeNotImplemented
 		} else {
 			reply.Rcode = dns.RcodeServerFailure
+			if ede := edeOfError(err); ede != nil {
+				replyEde(reply, ede)
+			}
 			logger.Error().Stack().Err(err).Msg("unknown error")
 		}
 		s.cacheReject(ctx, cacheKey, reply.Rcode)
+		return
+	}
+
+	limitTtl(msg, view.router.nextScheduleBoundary(question, time.Now()))
+	reply.Rcode = msg.Rcode
+	reply.Answer = msg.Answer
+	reply.Ns = msg.Ns
+	reply.Authoritative = msg.Authoritative
+	replyEde(reply, edeOf(msg)...)
+	if msg.Rcode == dns.RcodeSuccess || msg.Rcode == dns.RcodeNameError {
+		// the negative answer is cached with its SOA, RFC 2308
+		logger.Trace().Str("Rcode", dns.RcodeToString[reply.Rcode]).Msg("resolved")
+		s.cacheResolve(ctx, cacheKey, msg)
+	} else {
+		logger.Debug().
+			Str("Rcode", dns.RcodeToString[reply.Rcode]).
+			Msg("resolved")
+		s.cacheReject(ctx, cacheKey, reply.Rcode)
+	}
+}
+
+// resolve routes the question to its upstream and resolves it.
+// The aliases are the names already followed by cname rules, to detect loops.
+func (s *DnsServer) resolve(
+	ctx context.Context,
+	view *dnsView,
+	question dns.Question,
+	dnssec bool,
+	aliases []string,
+) (*dns.Msg, error) {
+	matched := view.router.search(ctx, question)
+	if matched == nil {
+		return nil, errNoUpstream
+	}
+	msg, err := s.resolveMatched(ctx, view, question, dnssec, matched, aliases)
+	if err != nil {
+		return nil, err
+	}
+	if matched.rule.Upstream.Block != "" {
+		addEde(msg, blockedEde(matched))
+	}
+	return msg, nil
+}
+
+// resolveMatched resolves the question with the rule found by the router.
+func (s *DnsServer) resolveMatched(
+	ctx context.Context,
+	view *dnsView,
+	question dns.Question,
+	dnssec bool,
+	matched *routerMatched,
+	aliases []string,
+) (*dns.Msg, error) {
+	rule := matched.rule
+	if rule.Upstream.Cname != "" {
+		return s.resolveAlias(ctx, view, question, dnssec, rule.Upstream.Cname, aliases)
+	}
+
+	resolver := client.GetByUpstream(ctx, matched.upstream)
+	if resolver == nil {
+		return nil, errNoResolver
+	}
+
+	msg, err := resolver.Resolve(ctx, question, dnssec)
+	if err != nil {
+		return nil, err
+	}
+	if matched.dns64 != nil && question.Qtype == dns.TypeAAAA {
+		msg = s.dns64(ctx, resolver, question, dnssec, matched.dns64, msg)
+	}
+	return msg, nil
+}
+
+// resolveAlias answers the question with a CNAME to the target, followed by the records of the target.
+func (s *DnsServer) resolveAlias(
+	ctx context.Context,
+	view *dnsView,
+	question dns.Question,
+	dnssec bool,
+	target string,
+	aliases []string,
+) (*dns.Msg, error) {
+	name := dns.CanonicalName(question.Name)
+	if slices.Contains(aliases, name) || len(aliases) >= maxAliasChain {
+		return nil, errors.Wrap(errAliasLoop, strings.Join(append(aliases, name), " -> "))
+	}
+	aliases = append(aliases, name)
+
+	zerolog.Ctx(ctx).
+		Debug().
+		Str("module", "server.handler").
+		Str("domain", question.Name).
+		Str("target", target).
+		Msg("alias")
+
+	cname := new(dns.CNAME)
+	cname.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60}
+	cname.Target = dns.Fqdn(target)
+	if question.Qtype == dns.TypeCNAME {
+		msg := new(dns.Msg)
+		msg.Answer = []dns.RR{cname}
+		return msg, nil
+	}
+
+	targetQuestion := question
+	targetQuestion.Name = cname.Target
+	msg, err := s.resolve(ctx, view, targetQuestion, dnssec, aliases)
+	if err != nil {
+		return nil, err
 	}
+	msg.Answer = append([]dns.RR{cname}, msg.Answer...)
+	return msg, nil
 }
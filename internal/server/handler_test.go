@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/phuslu/shardmap"
+)
+
+func newTestServer(t *testing.T, conf string) *DnsServer {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s := &DnsServer{
+		ctx:        ctx,
+		cache:      shardmap.New[string, *deferredAnswer](64),
+		configFile: file,
+	}
+	if err := s.Config.ReadConfigFile(file); err != nil {
+		t.Fatal(err)
+	}
+	s.SetupRouter()
+	return s
+}
+
+func testQuery(s *DnsServer, client string, name string, qtype uint16) *dns.Msg {
+	w := &testResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP(client), Port: 5353}}
+	request := new(dns.Msg).SetQuestion(dns.Fqdn(name), qtype)
+	request.SetEdns0(4096, false)
+	s.handleRequest(w, request, "")
+	return w.msg
+}
+
+func TestNegativeCache(t *testing.T) {
+	zone := filepath.Join(t.TempDir(), "home.lan.zone")
+	content := "$ORIGIN home.lan.\n@ 300 IN SOA ns admin 1 3600 600 86400 60\nnas 300 IN A 10.0.0.2\n"
+	if err := os.WriteFile(zone, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, `{ "rule": [ { "pattern": { "suffix": ["home.lan"] }, "upstream": { "zone": "`+zone+`" } } ] }`)
+
+	// the second reply is from the cache
+	for idx := range 2 {
+		reply := testQuery(s, "192.168.1.2", "missing.home.lan", dns.TypeA)
+		if s.cache.Len() != 1 {
+			t.Fatalf("%d: the negative answer is not cached", idx)
+		}
+		if reply.Rcode != dns.RcodeNameError || !reply.Authoritative {
+			t.Fatalf("%d: got %s, authoritative %v", idx, dns.RcodeToString[reply.Rcode], reply.Authoritative)
+		}
+		if len(reply.Ns) != 1 || reply.Ns[0].Header().Rrtype != dns.TypeSOA {
+			t.Fatalf("%d: no SOA, %v", idx, reply.Ns)
+		}
+		if ttl := reply.Ns[0].Header().Ttl; ttl > 60 {
+			t.Errorf("%d: TTL %d is longer than the minimum of the SOA", idx, ttl)
+		}
+	}
+}
+
+func TestBlockedEde(t *testing.T) {
+	s := newTestServer(t, `{ "rule": [
+		{ "pattern": { "domain": ["ads.example.com"], "client": ["192.168.1.0/24"] }, "upstream": { "block": "nxdomain", "block_soa": true } },
+		{ "pattern": { "suffix": ["example.com"] }, "upstream": { "block": "nxdomain", "block_soa": true } }
+	] }`)
+
+	// both rules share the cached answer, each reply names its own rule
+	tests := []struct {
+		client string
+		text   string
+	}{
+		{"192.168.1.2", "blocked by rule 0"},
+		{"10.0.0.2", "blocked by rule 1"},
+		{"192.168.1.2", "blocked by rule 0"},
+		{"10.0.0.2", "blocked by rule 1"},
+	}
+	for idx, tt := range tests {
+		reply := testQuery(s, tt.client, "ads.example.com", dns.TypeA)
+		var texts []string
+		for _, ede := range edeOf(reply) {
+			if ede.InfoCode == dns.ExtendedErrorCodeBlocked {
+				texts = append(texts, ede.ExtraText)
+			}
+		}
+		if len(texts) != 1 || texts[0] != tt.text {
+			t.Errorf("%d: %s got %q, want %q", idx, tt.client, texts, tt.text)
+		}
+	}
+	if s.cache.Len() != 1 {
+		t.Errorf("the answer is not shared, %d cached", s.cache.Len())
+	}
+}
@@ -2,18 +2,19 @@ package server
 
 import (
 	"context"
-	"errors"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "net/http/pprof" // #nosec
 
 	"github.com/miekg/dns"
 	"github.com/phuslu/shardmap"
+	"github.com/pkg/errors"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 
@@ -22,11 +23,16 @@ import (
 
 type DnsServer struct {
 	dnsServer     *dns.Server
+	viewServers   []*dns.Server
 	pprofServer   *http.Server
 	pprofListener net.Listener
+	adminServer   *http.Server
+	adminListener net.Listener
 	ctx           context.Context
-	router        *router
+	reloadSignal  <-chan os.Signal
+	views         atomic.Pointer[dnsViews]
 	cache         *shardmap.Map[string, *deferredAnswer]
+	configFile    string
 	Config        config.Config
 }
 
@@ -46,6 +52,7 @@ func NewDnsServer(ctx context.Context) *DnsServer {
 
 		server.shutdownDNS()
 		server.shutdownPprof()
+		server.shutdownAdmin()
 	}()
 
 	return server
@@ -56,8 +63,17 @@ func (s *DnsServer) SetupRouter() {
 		Debug().
 		Str("module", "server.main").
 		Msg("loading config")
-	s.router = newRouter()
-	s.router.addRules(s.ctx, s.Config.Rule, false)
+	views, err := newViews(s.ctx, &s.Config)
+	if err != nil {
+		zerolog.Ctx(s.ctx).
+			Error().
+			Str("module", "server.main").
+			Stack().
+			Err(err).
+			Send()
+		panic(err)
+	}
+	s.swapViews(views)
 }
 
 func (s *DnsServer) SetupServer() {
@@ -75,10 +91,33 @@ func (s *DnsServer) SetupServer() {
 				Str("server_addr", addr.String()).
 				Msg("DNS server is running")
 
-			s.router.addRules(s.ctx, s.Config.Rule, true)
+			s.views.Load().refreshRuleSets()
 		},
 	}
-	dnsMux.HandleFunc(".", s.handleRequest)
+	dnsMux.HandleFunc(".", func(w dns.ResponseWriter, request *dns.Msg) {
+		s.handleRequest(w, request, "")
+	})
+
+	// queries to the listener of a view always use the view
+	for _, view := range s.views.Load().views {
+		for _, listen := range view.listen {
+			s.viewServers = append(s.viewServers, &dns.Server{
+				Addr: listen,
+				Net:  "udp",
+				Handler: dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+					s.handleRequest(w, request, listen)
+				}),
+				NotifyStartedFunc: func() {
+					zerolog.Ctx(s.ctx).
+						Info().
+						Str("module", "server.main").
+						Str("view", view.name).
+						Str("server_addr", listen).
+						Msg("DNS server of view is running")
+				},
+			})
+		}
+	}
 }
 
 func (s *DnsServer) SetupPprof() {
@@ -106,7 +145,7 @@ func (s *DnsServer) SetupPprof() {
 
 func (s *DnsServer) Start() {
 	var wg sync.WaitGroup
-	wg.Add(3)
+	wg.Add(5)
 
 	go func() {
 		s.cleanupExpiredCache()
@@ -123,32 +162,56 @@ func (s *DnsServer) Start() {
 		wg.Done()
 	}()
 
+	go func() {
+		s.startAdmin()
+		wg.Done()
+	}()
+
+	go func() {
+		s.startReload()
+		wg.Done()
+	}()
+
 	wg.Wait()
 }
 
 func (s *DnsServer) startDNS() {
-	err := s.dnsServer.ListenAndServe()
-	if err != nil {
-		zerolog.Ctx(s.ctx).
-			Error().
-			Str("module", "server.main").
-			Stack().
-			Err(err).
-			Send()
-		panic(err)
+	var wg sync.WaitGroup
+	for _, server := range append([]*dns.Server{s.dnsServer}, s.viewServers...) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := server.ListenAndServe()
+			if err != nil {
+				zerolog.Ctx(s.ctx).
+					Error().
+					Str("module", "server.main").
+					Stack().
+					Err(err).
+					Send()
+				panic(err)
+			}
+		}()
 	}
+	wg.Wait()
 }
 
 func (s *DnsServer) shutdownDNS() {
-	err := s.dnsServer.Shutdown()
-	if err != nil {
-		zerolog.Ctx(s.ctx).
-			Error().
-			Str("module", "server.main").
-			Stack().
-			Err(err).
-			Send()
-		panic(err)
+	if s.dnsServer == nil {
+		// failed before the server is set up
+		return
+	}
+	for _, server := range append([]*dns.Server{s.dnsServer}, s.viewServers...) {
+		err := server.Shutdown()
+		if err != nil {
+			zerolog.Ctx(s.ctx).
+				Error().
+				Str("module", "server.main").
+				Stack().
+				Err(err).
+				Send()
+			panic(err)
+		}
 	}
 }
 
@@ -179,6 +242,9 @@ func (s *DnsServer) startPprof() {
 
 // nolint: contextcheck
 func (s *DnsServer) shutdownPprof() {
+	if s.pprofServer == nil {
+		return
+	}
 	err := s.pprofServer.Shutdown(context.Background())
 	if err != nil {
 		zerolog.Ctx(s.ctx).
@@ -0,0 +1,6 @@
+//go:build race
+
+package server
+
+// sync.Pool drops items randomly with the race detector.
+const raceEnabled = true
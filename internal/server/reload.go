@@ -0,0 +1,128 @@
+package server
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/client"
+	"github.com/dhcmrlchtdj/godns/internal/config"
+	"github.com/dhcmrlchtdj/godns/internal/util"
+)
+
+// the interval to check whether the config file changed
+const reloadWatchInterval = 2 * time.Second
+
+// SetupReload reloads the config on the signals, the config file is also watched.
+func (s *DnsServer) SetupReload(signals <-chan os.Signal) {
+	s.reloadSignal = signals
+}
+
+func (s *DnsServer) startReload() {
+	if s.configFile == "" {
+		return
+	}
+
+	logger := zerolog.Ctx(s.ctx).
+		With().
+		Str("module", "server.reload").
+		Str("path", s.configFile).
+		Logger()
+
+	watcher := util.MakeFileWatcher(0, reloadFiles(s.configFile, s.views.Load().conf)...)
+	ticker := time.NewTicker(reloadWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.reloadSignal:
+			logger.Info().Msg("reload on signal")
+		case <-ticker.C:
+			if !watcher.Changed() {
+				continue
+			}
+			logger.Info().Msg("reload on file change")
+		}
+
+		if err := s.Reload(); err != nil {
+			logger.Error().Stack().Err(err).Msg("failed to reload, keep the old config")
+			continue
+		}
+		watcher = util.MakeFileWatcher(0, reloadFiles(s.configFile, s.views.Load().conf)...)
+	}
+}
+
+// Reload rebuilds the views from the config file, they are swapped in only if the config is valid.
+// The listeners are not changed, so host, port, admin and the listen of views need a restart.
+// The cache is kept, answers are shared by questions with the same route.
+func (s *DnsServer) Reload() error {
+	conf := new(config.Config)
+	if err := conf.ReadConfigFile(s.configFile); err != nil {
+		return err
+	}
+	conf.Host = s.Config.Host
+	conf.Port = s.Config.Port
+	conf.Admin = s.Config.Admin
+	conf.LogLevel = s.Config.LogLevel
+
+	views, err := newViews(s.ctx, conf)
+	if err != nil {
+		return errors.WithMessage(err, s.configFile)
+	}
+	old := s.views.Load()
+	views.loadRuleSets(old)
+	if !sameListen(old, views) {
+		zerolog.Ctx(s.ctx).
+			Warn().
+			Str("module", "server.reload").
+			Msg("the listen of views is changed, it needs a restart")
+	}
+
+	s.swapViews(views)
+	client.ResetResolvers()
+	views.refreshRuleSets()
+
+	zerolog.Ctx(s.ctx).
+		Info().
+		Str("module", "server.reload").
+		Int("rules", len(conf.Rule)).
+		Int("views", len(conf.View)).
+		Msg("config reloaded")
+	return nil
+}
+
+// reloadFiles returns the config file and the local lists used by rules.
+// Hosts and zone files are watched by their resolvers.
+func reloadFiles(configFile string, conf *config.Config) []string {
+	files := []string{configFile}
+	if conf.Geosite != "" {
+		files = append(files, conf.Geosite)
+	}
+	rules := slices.Clip(conf.Rule)
+	for _, view := range conf.View {
+		rules = append(rules, view.Rule...)
+	}
+	for _, rule := range rules {
+		files = append(files, rule.Pattern.DomainList...)
+		files = append(files, rule.Pattern.DnsmasqList...)
+		if rule.Pattern.Builtin == "adblock" {
+			for _, source := range rule.Pattern.BuiltinList {
+				if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+					files = append(files, source)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// sameListen reports whether the listeners of views are the same.
+func sameListen(a *dnsViews, b *dnsViews) bool {
+	return maps.Equal(a.listenOf(), b.listenOf())
+}
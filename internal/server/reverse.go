@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/client"
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+// reverseIndex maps the reverse name of locally defined addresses to their domains.
+// The addresses come from ipv4 and ipv6 rules of exact domains, and from hosts and zone files.
+type reverseIndex struct {
+	names map[string][]string
+	local []*config.Upstream // hosts and zone files, they may change after the index is built
+}
+
+func newReverseIndex(ctx context.Context, rules []*config.Rule) reverseIndex {
+	index := reverseIndex{names: make(map[string][]string)}
+	for _, rule := range rules {
+		pat := &rule.Pattern
+		if len(pat.Client) > 0 || len(rule.Schedule) > 0 || (len(pat.Class) > 0 && !slices.Contains(pat.Class, "IN")) {
+			// the address is not the answer of every query
+			continue
+		}
+
+		up := upstreamOf(rule)
+		if up.Zone != "" || len(up.Hosts) > 0 {
+			if answersRecord(pat, "A") || answersRecord(pat, "AAAA") {
+				index.local = append(index.local, up)
+			}
+			continue
+		}
+
+		var ip string
+		if up.Ipv4 != "" && answersRecord(pat, "A") {
+			ip = up.Ipv4
+		} else if up.Ipv6 != "" && answersRecord(pat, "AAAA") {
+			ip = up.Ipv6
+		}
+		if ip == "" {
+			continue
+		}
+		reverse, err := dns.ReverseAddr(ip)
+		if err != nil {
+			continue
+		}
+		// a suffix is not a name of the address
+		for _, domain := range pat.Domain {
+			name := dns.CanonicalName(domain)
+			if name == "." || slices.Contains(index.names[reverse], name) {
+				continue
+			}
+			index.names[reverse] = append(index.names[reverse], name)
+
+			zerolog.Ctx(ctx).
+				Trace().
+				Str("module", "server.reverse").
+				Str("reverse", reverse).
+				Str("domain", name).
+				Msg("added")
+		}
+	}
+	return index
+}
+
+// answersRecord checks whether the pattern matches the record.
+func answersRecord(pat *config.Pattern, record string) bool {
+	return (len(pat.Record) == 0 || slices.Contains(pat.Record, record)) && !slices.Contains(pat.ExcludeRecord, record)
+}
+
+func (index reverseIndex) lookup(ctx context.Context, question dns.Question) []dns.RR {
+	reverse := dns.CanonicalName(question.Name)
+	names := index.names[reverse]
+	for _, up := range index.local {
+		resolver, ok := client.GetByUpstream(ctx, up).(client.ReverseResolver)
+		if !ok {
+			continue
+		}
+		for _, name := range resolver.ReverseNames(ctx, reverse) {
+			if !slices.Contains(names, name) {
+				names = append(slices.Clip(names), name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	answer := make([]dns.RR, 0, len(names))
+	for _, name := range names {
+		rr := new(dns.PTR)
+		rr.Hdr = dns.RR_Header{Name: question.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 60}
+		rr.Ptr = name
+		answer = append(answer, rr)
+	}
+	return answer
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+func TestReverseIndex(t *testing.T) {
+	hosts := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hosts, []byte("192.168.1.3 printer.lan\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules := []*config.Rule{
+		{Pattern: config.Pattern{Domain: []string{"nas.lan"}, Suffix: []string{"lan"}}, Upstream: config.Upstream{Ipv4: "192.168.1.2"}},
+		{Pattern: config.Pattern{Suffix: []string{"."}}, Upstream: config.Upstream{Ipv4: "192.168.1.9"}},
+		{Pattern: config.Pattern{Domain: []string{"aaaa.lan"}, Record: []string{"AAAA"}}, Upstream: config.Upstream{Ipv4: "192.168.1.4"}},
+		{Pattern: config.Pattern{Domain: []string{"kid.lan"}, Client: []string{"10.0.0.1"}}, Upstream: config.Upstream{Ipv4: "192.168.1.5"}},
+		{Pattern: config.Pattern{Domain: []string{"work.lan"}}, Schedule: []*config.Schedule{{Start: "09:00", End: "17:00"}}, Upstream: config.Upstream{Ipv4: "192.168.1.6"}},
+		{Pattern: config.Pattern{Suffix: []string{"lan"}}, Upstream: config.Upstream{Hosts: []string{hosts}}},
+	}
+	index := newReverseIndex(context.Background(), rules)
+
+	tests := []struct {
+		addr  string
+		names []string
+	}{
+		{"192.168.1.2", []string{"nas.lan."}},
+		{"192.168.1.9", nil},
+		{"192.168.1.4", nil},
+		{"192.168.1.5", nil},
+		{"192.168.1.6", nil},
+		{"192.168.1.3", []string{"printer.lan."}},
+	}
+	for _, tt := range tests {
+		reverse, _ := dns.ReverseAddr(tt.addr)
+		var names []string
+		for _, rr := range index.lookup(context.Background(), dns.Question{Name: reverse, Qtype: dns.TypePTR, Qclass: dns.ClassINET}) {
+			names = append(names, rr.(*dns.PTR).Ptr)
+		}
+		if !slices.Equal(names, tt.names) {
+			t.Errorf("%s: got %v, want %v", tt.addr, names, tt.names)
+		}
+	}
+}
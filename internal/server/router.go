@@ -2,9 +2,18 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/dhcmrlchtdj/godns/internal/config"
@@ -12,198 +21,569 @@ import (
 )
 
 type router struct {
-	domain                 *routerNode
-	domainSuffix           *routerNode
-	domainWithRecord       map[uint16]*routerNode
-	domainSuffixWithRecord map[uint16]*routerNode
+	domain        *routerTrie
+	domainSuffix  *routerTrie
+	regex         []routerRegex
+	regexAny      *regexp.Regexp
+	keyword       *routerKeywords
+	glob          *routerGlobNode
+	ruleSets      []*routerRuleSet
+	scheduleRules []*routerMatched // rules with schedules
+	firstMatch    bool             // the rule defined earlier wins, instead of the most specific one
+	longestMatch  bool             // the deeper suffix wins across tiers, instead of the rule defined earlier
 }
-type routerNode struct {
-	next    map[string]*routerNode
+type routerMatched struct {
+	rule           *config.Rule
+	upstream       *config.Upstream // the upstream of the rule, with the fields set by the router
+	dns64          *dns64Networks   // parsed from rule.Dns64
+	route          string           // answers of the same route are shared in cache
+	records        []uint16         // if not empty, only these records are matched
+	excludeRecords []uint16
+	classes        []uint16          // if not empty, only these classes are matched
+	clients        []netip.Prefix    // if not empty, only these clients are matched
+	schedules      []*routerSchedule // if not empty, only matched when any schedule is active
+	priority       int               // smaller means higher priority
+	withRecord     bool              // the rule is for some records, which is preferred over rules for all records
+	allow          bool              // an exception, the rule is skipped
+	important      bool              // not affected by exceptions
+}
+type routerCandidate struct {
 	matched *routerMatched
+	pattern string // regex, keyword or glob, empty for domains and suffixes
+	depth   int
 }
-type routerMatched struct {
-	upstream *config.Upstream
-	priority int // smaller means higher priority
+type routerCandidates struct {
+	domainWithRecord       []routerCandidate
+	domain                 []routerCandidate
+	domainSuffixWithRecord []routerCandidate
+	domainSuffix           []routerCandidate
 }
 
 ///
 
 func newRouter() *router {
 	return &router{
-		domain:                 new(routerNode),
-		domainSuffix:           new(routerNode),
-		domainWithRecord:       make(map[uint16]*routerNode),
-		domainSuffixWithRecord: make(map[uint16]*routerNode),
+		domain:       new(routerTrie),
+		domainSuffix: new(routerTrie),
 	}
 }
 
-func (r *router) addRules(ctx context.Context, rules []*config.Rule, serverStarted bool) {
+func (r *router) addRules(ctx context.Context, conf *config.Config, rules []*config.Rule) error {
+	r.firstMatch = conf.Match == "first"
+	r.longestMatch = conf.Match == "longest"
+	var geosite *util.Geosite
 	for priority, rule := range rules {
+		upstream := upstreamOf(rule)
+		// the matched is shared by all domains of the rule
+		matched := &routerMatched{
+			rule:       rule,
+			upstream:   upstream,
+			route:      routeOf(rule.Dns64, upstream),
+			priority:   priority,
+			withRecord: len(rule.Pattern.Record) > 0,
+		}
+		for _, record := range rule.Pattern.Record {
+			matched.records = append(matched.records, dns.StringToType[record])
+		}
+		for _, record := range rule.Pattern.ExcludeRecord {
+			matched.excludeRecords = append(matched.excludeRecords, dns.StringToType[record])
+		}
+		for _, class := range rule.Pattern.Class {
+			matched.classes = append(matched.classes, dns.StringToClass[class])
+		}
+		matched.clients = parseClients(conf.Client, rule.Pattern.Client)
+		matched.schedules = parseSchedules(rule.Schedule)
+		matched.dns64 = parseDns64(rule.Dns64)
+		if len(matched.schedules) > 0 {
+			r.scheduleRules = append(r.scheduleRules, matched)
+		}
+
+		// an exclusion skips the rule, so the next matching rule is used
+		exclusion := &routerMatched{rule: rule, priority: priority, allow: true, important: true}
+		for _, domain := range rule.Pattern.ExcludeDomain {
+			r.addDomain(ctx, domain, false, exclusion)
+		}
+		for _, domain := range rule.Pattern.ExcludeSuffix {
+			r.addDomain(ctx, domain, true, exclusion)
+		}
+
 		if rule.Pattern.Builtin == "china-list" {
-			if serverStarted {
-				suffix, err := util.MakeChinaList(ctx, rule.Pattern.BuiltinProxy).Fetch()
-				if err == nil {
-					for _, domain := range suffix {
-						r.addDomain(ctx, priority, domain, true, rule.Pattern.Record, &rule.Upstream)
-					}
-				} else {
+			r.addRuleSet(ctx, "china-list", &config.RuleSet{
+				Url:    util.CHINA_LIST_URL,
+				Format: "dnsmasq",
+				Proxy:  rule.Pattern.BuiltinProxy,
+			}, matched)
+		}
+
+		if rule.Pattern.Builtin == "adblock" {
+			for _, source := range rule.Pattern.BuiltinList {
+				if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+					r.addRuleSet(ctx, source, &config.RuleSet{
+						Url:    source,
+						Format: "adblock",
+						Proxy:  rule.Pattern.BuiltinProxy,
+					}, matched)
+					continue
+				}
+				filters, err := util.LoadRuleList(source, "adblock")
+				if err != nil {
 					zerolog.Ctx(ctx).
 						Error().
 						Str("module", "server.router").
+						Str("source", source).
 						Err(err).
-						Msg("failed to load china-list")
+						Msg("failed to load filter list")
+					continue
+				}
+				for idx := range filters {
+					r.addFilter(ctx, &filters[idx], matched)
 				}
 			}
 		}
 
-		if !serverStarted {
-			for _, domain := range rule.Pattern.Domain {
-				r.addDomain(ctx, priority, domain, false, rule.Pattern.Record, &rule.Upstream)
+		if rule.Pattern.Builtin == "private-reverse" {
+			for _, zone := range util.LocalZones {
+				localRule := &config.Rule{
+					Pattern:  rule.Pattern,
+					Upstream: config.Upstream{EmptyZone: zone},
+				}
+				localMatched := *matched
+				localMatched.rule = localRule
+				localMatched.upstream = &localRule.Upstream
+				localMatched.route = routeOf(localRule.Dns64, &localRule.Upstream)
+				r.addDomain(ctx, zone, true, &localMatched)
 			}
-			for _, domain := range rule.Pattern.Suffix {
-				r.addDomain(ctx, priority, domain, true, rule.Pattern.Record, &rule.Upstream)
+		}
+
+		for _, name := range rule.Pattern.RuleSet {
+			r.addRuleSet(ctx, name, conf.RuleSet[name], matched)
+		}
+
+		for _, domain := range rule.Pattern.Domain {
+			r.addDomain(ctx, domain, false, matched)
+		}
+		for _, domain := range rule.Pattern.Suffix {
+			r.addDomain(ctx, domain, true, matched)
+		}
+		for _, pattern := range rule.Pattern.Regex {
+			r.addFilter(ctx, &util.FilterRule{Regex: regexp.MustCompile(pattern)}, matched)
+		}
+		for _, pattern := range rule.Pattern.Keyword {
+			r.addFilter(ctx, &util.FilterRule{Keyword: strings.ToLower(pattern)}, matched)
+		}
+		for _, pattern := range rule.Pattern.Glob {
+			r.addFilter(ctx, &util.FilterRule{Glob: strings.ToLower(pattern)}, matched)
+		}
+
+		for _, list := range rule.Pattern.DomainList {
+			if err := r.addRuleList(ctx, list, "domain", matched); err != nil {
+				return err
 			}
 		}
+		for _, list := range rule.Pattern.DnsmasqList {
+			if err := r.addRuleList(ctx, list, "dnsmasq", matched); err != nil {
+				return err
+			}
+		}
+
+		if len(rule.Pattern.Geosite) > 0 && geosite == nil {
+			var err error
+			geosite, err = util.LoadGeosite(conf.Geosite)
+			if err != nil {
+				return errors.WithMessage(err, conf.Geosite)
+			}
+		}
+		for _, category := range rule.Pattern.Geosite {
+			filters, err := geosite.Rules(category)
+			if err != nil {
+				return err
+			}
+			for idx := range filters {
+				r.addFilter(ctx, &filters[idx], matched)
+			}
+			zerolog.Ctx(ctx).
+				Debug().
+				Str("module", "server.router").
+				Str("geosite", category).
+				Int("domains", len(filters)).
+				Msg("geosite loaded")
+		}
+	}
+	r.compile()
+	return nil
+}
+
+// addRuleList adds the domains of a local list file.
+func (r *router) addRuleList(ctx context.Context, path string, format string, matched *routerMatched) error {
+	filters, err := util.LoadRuleList(path, format)
+	if err != nil {
+		return err
+	}
+	for idx := range filters {
+		r.addFilter(ctx, &filters[idx], matched)
+	}
+	zerolog.Ctx(ctx).
+		Debug().
+		Str("module", "server.router").
+		Str("path", path).
+		Int("domains", len(filters)).
+		Msg("domain list loaded")
+	return nil
+}
+
+func (r *router) addFilter(ctx context.Context, filter *util.FilterRule, matched *routerMatched) {
+	if filter.Allow || filter.Important || len(filter.Records) > 0 || len(filter.ExcludeRecords) > 0 {
+		records := matched.records
+		if len(filter.Records) > 0 {
+			records = filter.Records
+			if len(matched.records) > 0 {
+				records = intersectRecords(matched.records, filter.Records)
+				if len(records) == 0 {
+					return
+				}
+			}
+		}
+		filterMatched := *matched
+		filterMatched.records = records
+		filterMatched.excludeRecords = append(slices.Clip(matched.excludeRecords), filter.ExcludeRecords...)
+		filterMatched.allow = filter.Allow
+		filterMatched.important = filter.Important
+		matched = &filterMatched
+	}
+
+	if filter.Regex == nil && filter.Keyword == "" && filter.Glob == "" {
+		r.addDomain(ctx, filter.Domain, !filter.Exact, matched)
+		return
+	}
+
+	logger := zerolog.Ctx(ctx).
+		Trace().
+		Str("module", "server.router").
+		Int("priority", matched.priority).
+		Bool("allow", matched.allow)
+	if filter.Regex != nil {
+		r.addRegex(filter.Regex, matched)
+		logger.Str("regex", filter.Regex.String()).Msg("added")
+	} else if filter.Keyword != "" {
+		r.addKeyword(filter.Keyword, matched)
+		logger.Str("keyword", filter.Keyword).Msg("added")
+	} else {
+		r.addGlob(filter.Glob, matched)
+		logger.Str("glob", filter.Glob).Msg("added")
 	}
 }
 
 func (r *router) addDomain(
 	ctx context.Context,
-	priority int,
 	domain string,
 	isSuffix bool,
-	record string,
-	upstream *config.Upstream,
+	matched *routerMatched,
 ) {
 	zerolog.Ctx(ctx).
 		Trace().
 		Str("module", "server.router").
-		Int("priority", priority).
+		Int("priority", matched.priority).
 		Str("domain", domain).
 		Bool("isSuffix", isSuffix).
-		Str("record", record).
+		Strs("record", matched.rule.Pattern.Record).
+		Bool("allow", matched.allow).
 		Msg("added")
 
-	if record != "" {
-		recordRouter := r.domainWithRecord
-		if isSuffix {
-			recordRouter = r.domainSuffixWithRecord
-		}
+	if isSuffix {
+		r.domainSuffix.add(domain, matched)
+	} else {
+		r.domain.add(domain, matched)
+	}
+}
 
-		recordType := dns.StringToType[record]
-		node, found := recordRouter[recordType]
-		if !found {
-			node = new(routerNode)
-			recordRouter[recordType] = node
+func (r *router) search(ctx context.Context, question dns.Question) *routerMatched {
+	name := strings.TrimSuffix(dns.CanonicalName(question.Name), ".")
+	client := clientAddrOf(ctx)
+	now := time.Now()
+
+	cs := routerCandidatesPool.Get().(*routerCandidates)
+	defer func() {
+		cs.reset()
+		routerCandidatesPool.Put(cs)
+	}()
+	r.collect(name, cs)
+
+	tiers, best, _ := r.pick(cs, question, client, now)
+	if best == -1 {
+		zerolog.Ctx(ctx).
+			Trace().
+			Str("module", "server.router").
+			Str("domain", question.Name).
+			Str("record", dns.TypeToString[question.Qtype]).
+			Bool("found", false).
+			Send()
+		return nil
+	}
+	matched := tiers[best].picked.matched
+	// zerolog.Dict allocates even if the level is disabled
+	if event := zerolog.Ctx(ctx).Trace(); event.Enabled() {
+		event.
+			Str("module", "server.router").
+			Str("domain", question.Name).
+			Str("record", dns.TypeToString[question.Qtype]).
+			Dict("match", zerolog.Dict().
+				Bool("record", tiers[best].record).
+				Bool("suffix", tiers[best].suffix).
+				Int("priority", matched.priority)).
+			Bool("found", true).
+			Send()
+	}
+	return matched
+}
+
+// routerCandidatesPool reuses the candidates, so searching doesn't allocate.
+var routerCandidatesPool = sync.Pool{New: func() any { return new(routerCandidates) }}
+
+// reset keeps the capacity, the matched are cleared so they can be released with the old router.
+func (cs *routerCandidates) reset() {
+	clear(cs.domainWithRecord)
+	clear(cs.domain)
+	clear(cs.domainSuffixWithRecord)
+	clear(cs.domainSuffix)
+	cs.domainWithRecord = cs.domainWithRecord[:0]
+	cs.domain = cs.domain[:0]
+	cs.domainSuffixWithRecord = cs.domainSuffixWithRecord[:0]
+	cs.domainSuffix = cs.domainSuffix[:0]
+}
+
+type routerTier struct {
+	picked     *routerCandidate
+	candidates []routerCandidate
+	record     bool
+	suffix     bool
+}
+
+// pick returns the candidate of each tier, the index of the best tier (-1 if none), and the excluded rules.
+func (r *router) pick(
+	cs *routerCandidates,
+	question dns.Question,
+	client netip.Addr,
+	now time.Time,
+) ([4]routerTier, int, []int) {
+	c1, c2, c3, c4 := cs.domainWithRecord, cs.domain, cs.domainSuffixWithRecord, cs.domainSuffix
+	excluded := excludedRules(question, client, now, c1, c2, c3, c4)
+
+	tiers := [4]routerTier{
+		{candidates: c1, record: true, suffix: false},
+		{candidates: c2, record: false, suffix: false},
+		{candidates: c3, record: true, suffix: true},
+		{candidates: c4, record: false, suffix: true},
+	}
+	best := -1
+	for idx := range tiers {
+		tier := &tiers[idx]
+		tier.picked = r.pickCandidate(tier.candidates, question, client, now, excluded)
+		if tier.picked == nil {
+			continue
+		}
+		if best == -1 {
+			best = idx
+			continue
+		}
+		curr := tiers[best].picked
+		if r.firstMatch {
+			// the rule defined earlier wins
+			if tier.picked.matched.priority < curr.matched.priority {
+				best = idx
+			}
+		} else if tier.suffix && tiers[best].suffix {
+			// a domain is preferred over suffixes,
+			// then the deeper suffix wins with longestMatch, otherwise the rule defined earlier wins
+			if (r.longestMatch && deeper(tier.picked, curr)) ||
+				(!r.longestMatch && tier.picked.matched.priority < curr.matched.priority) {
+				best = idx
+			}
 		}
+	}
+	return tiers, best, excluded
+}
 
-		node.addDomain(priority, domain, upstream)
+// addSuffix adds the candidate of a suffix or a pattern to the tier of its rule.
+func (cs *routerCandidates) addSuffix(c routerCandidate) {
+	if c.matched.withRecord {
+		cs.domainSuffixWithRecord = append(cs.domainSuffixWithRecord, c)
 	} else {
-		if isSuffix {
-			r.domainSuffix.addDomain(priority, domain, upstream)
-		} else {
-			r.domain.addDomain(priority, domain, upstream)
-		}
+		cs.domainSuffix = append(cs.domainSuffix, c)
 	}
 }
 
-func (r *router) search(ctx context.Context, domain string, record uint16) *config.Upstream {
-	logger := zerolog.Ctx(ctx).
-		With().
-		Str("module", "server.router").
-		Str("domain", domain).
-		Str("record", dns.TypeToString[record]).
-		Logger()
-
-	segments := domainToSegments(domain)
-
-	c1, m1 := r.domainWithRecord[record].searchSegments(segments)
-	if m1 != nil && c1 == len(segments) {
-		logger.Trace().Dict("match", zerolog.Dict().Bool("record", true).Bool("suffix", false).Int("priority", m1.priority)).Bool("found", true).Send()
-		return m1.upstream
-	}
-
-	c2, m2 := r.domain.searchSegments(segments)
-	if m2 != nil && c2 == len(segments) {
-		logger.Trace().Dict("match", zerolog.Dict().Bool("record", false).Bool("suffix", false).Int("priority", m2.priority)).Bool("found", true).Send()
-		return m2.upstream
-	}
-
-	_, m3 := r.domainSuffixWithRecord[record].searchSegments(segments)
-	_, m4 := r.domainSuffix.searchSegments(segments)
-	if m3 != nil && m4 != nil {
-		// if c3 > c4 {
-		//     logger.Trace().Dict("match", zerolog.Dict().Bool("record", true).Bool("suffix", true).Int("priority", m3.priority)).Bool("found", true).Send()
-		//     return m3.upstream
-		// } else if c3 < c4 {
-		//     logger.Trace().Dict("match", zerolog.Dict().Bool("record", false).Bool("suffix", true).Int("priority", m4.priority)).Bool("found", true).Send()
-		//     return m4.upstream
-		// }
-		if m3.priority <= m4.priority {
-			logger.Trace().Dict("match", zerolog.Dict().Bool("record", true).Bool("suffix", true).Int("priority", m3.priority)).Bool("found", true).Send()
-			return m3.upstream
+// collect adds the candidates of the router and its rule sets, the name must be canonical.
+func (r *router) collect(name string, cs *routerCandidates) {
+	r.domain.collect(name, false, func(c routerCandidate) {
+		if c.matched.withRecord {
+			cs.domainWithRecord = append(cs.domainWithRecord, c)
 		} else {
-			logger.Trace().Dict("match", zerolog.Dict().Bool("record", false).Bool("suffix", true).Int("priority", m4.priority)).Bool("found", true).Send()
-			return m4.upstream
+			cs.domain = append(cs.domain, c)
+		}
+	})
+	r.domainSuffix.collect(name, true, cs.addSuffix)
+	r.collectPatterns(name, cs)
+	for _, ruleSet := range r.ruleSets {
+		if data := ruleSet.data.Load(); data != nil {
+			data.collect(name, cs)
 		}
-	} else if m3 != nil {
-		logger.Trace().Dict("match", zerolog.Dict().Bool("record", true).Bool("suffix", true).Int("priority", m3.priority)).Bool("found", true).Send()
-		return m3.upstream
-	} else if m4 != nil {
-		logger.Trace().Dict("match", zerolog.Dict().Bool("record", false).Bool("suffix", true).Int("priority", m4.priority)).Bool("found", true).Send()
-		return m4.upstream
 	}
-
-	logger.Trace().Bool("found", false).Send()
-	return nil
 }
 
-///
+// excludedRules returns the priority of rules skipped by their exceptions.
+// An important rule is not skipped, unless the exception is also important.
+func excludedRules(question dns.Question, client netip.Addr, now time.Time, candidates ...[]routerCandidate) []int {
+	var allowed, allowedImportant, important []int
+	for _, cs := range candidates {
+		for _, c := range cs {
+			m := c.matched
+			if !m.match(question, client, now) {
+				continue
+			}
+			if m.allow && m.important {
+				allowedImportant = append(allowedImportant, m.priority)
+			} else if m.allow {
+				allowed = append(allowed, m.priority)
+			} else if m.important {
+				important = append(important, m.priority)
+			}
+		}
+	}
 
-func (node *routerNode) searchSegments(segments []string) (int, *routerMatched) {
-	if node == nil {
-		return 0, nil
+	excluded := allowedImportant
+	for _, priority := range allowed {
+		if !slices.Contains(important, priority) {
+			excluded = append(excluded, priority)
+		}
 	}
+	return excluded
+}
 
-	curr := node
-	longestMatch := 0
-	segmentCount := 0
-	var matched *routerMatched = curr.matched
-	for _, segment := range segments {
-		if curr.next == nil {
-			break
+// pickCandidate returns the deepest candidate, then the one with the highest priority.
+// With firstMatch, only the priority is compared.
+// Regex and keyword are compared with the picked one of the trie and glob by priority,
+// so the result doesn't depend on the order of candidates.
+func (r *router) pickCandidate(
+	candidates []routerCandidate,
+	question dns.Question,
+	client netip.Addr,
+	now time.Time,
+	excluded []int,
+) *routerCandidate {
+	var picked, pattern *routerCandidate
+	for idx := range candidates {
+		c := &candidates[idx]
+		if c.matched.allow || !c.matched.match(question, client, now) || slices.Contains(excluded, c.matched.priority) {
+			continue
 		}
-		next, found := curr.next[segment]
-		if !found {
-			break
+		if c.depth == patternDepth {
+			if pattern == nil || c.matched.priority < pattern.matched.priority {
+				pattern = c
+			}
+		} else if picked == nil ||
+			(r.firstMatch && c.matched.priority < picked.matched.priority) ||
+			(!r.firstMatch && deeper(c, picked)) {
+			picked = c
 		}
-		curr = next
-		segmentCount++
-		if curr.matched != nil {
-			longestMatch = segmentCount
-			matched = curr.matched
+	}
+	if pattern != nil && (picked == nil || pattern.matched.priority < picked.matched.priority) {
+		return pattern
+	}
+	return picked
+}
+
+// deeper reports whether c is preferred over the other candidate by depth, then by priority.
+// Candidates of regex and keyword are compared by priority only.
+func deeper(c *routerCandidate, other *routerCandidate) bool {
+	if c.depth == other.depth || c.depth == patternDepth || other.depth == patternDepth {
+		return c.matched.priority < other.matched.priority
+	}
+	return c.depth > other.depth
+}
+
+func (m *routerMatched) match(question dns.Question, client netip.Addr, now time.Time) bool {
+	if len(m.records) > 0 && !slices.Contains(m.records, question.Qtype) {
+		return false
+	}
+	if len(m.clients) > 0 && !containsClient(m.clients, client) {
+		return false
+	}
+	if !m.matchSchedule(now) {
+		return false
+	}
+	if len(m.classes) > 0 && !slices.Contains(m.classes, question.Qclass) {
+		return false
+	}
+	return !slices.Contains(m.excludeRecords, question.Qtype)
+}
+
+func containsClient(prefixes []netip.Prefix, client netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(client) {
+			return true
 		}
 	}
-	return longestMatch, matched
+	return false
+}
+
+// routeOf identifies where the rule sends queries.
+// Unlike the priority, it's stable when other rules change, so the cache survives a reload.
+func routeOf(dns64 *config.Dns64, upstream *config.Upstream) string {
+	data, _ := json.Marshal(struct {
+		Dns64      *config.Dns64
+		Upstream   *config.Upstream
+		EmptyZone  string
+		ZoneOrigin string
+	}{dns64, upstream, upstream.EmptyZone, upstream.ZoneOrigin})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:8])
+}
+
+// upstreamOf returns the upstream of the rule, the config is not changed.
+// A zone file is copied with the origin of the rule.
+func upstreamOf(rule *config.Rule) *config.Upstream {
+	if rule.Upstream.Zone == "" {
+		return &rule.Upstream
+	}
+	upstream := rule.Upstream
+	upstream.ZoneOrigin = zoneOrigin(&rule.Pattern)
+	return &upstream
 }
 
-func (node *routerNode) addDomain(priority int, domain string, upstream *config.Upstream) {
-	segments := domainToSegments(domain)
-	curr := node
-	for _, segment := range segments {
-		if curr.next == nil {
-			curr.next = make(map[string]*routerNode)
+// zoneOrigin returns the only domain of the pattern, relative names in the zone file are under it.
+func zoneOrigin(pat *config.Pattern) string {
+	names := slices.Concat(pat.Domain, pat.Suffix)
+	if len(names) != 1 {
+		return ""
+	}
+	return dns.Fqdn(strings.Trim(strings.ToLower(names[0]), "."))
+}
+
+// parseClients resolves the client groups.
+func parseClients(groups map[string][]string, clients []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, client := range clients {
+		if prefix, ok := config.ParseClient(client); ok {
+			prefixes = append(prefixes, prefix)
+			continue
 		}
-		next, found := curr.next[segment]
-		if !found {
-			next = new(routerNode)
-			curr.next[segment] = next
+		for _, member := range groups[client] {
+			if prefix, ok := config.ParseClient(member); ok {
+				prefixes = append(prefixes, prefix)
+			}
 		}
-		curr = next
 	}
-	if curr.matched == nil || curr.matched.priority > priority {
-		curr.matched = &routerMatched{upstream, priority}
+	return prefixes
+}
+
+func intersectRecords(a []uint16, b []uint16) []uint16 {
+	var records []uint16
+	for _, record := range b {
+		if slices.Contains(a, record) {
+			records = append(records, record)
+		}
 	}
+	return records
 }
 
 ///
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The patterns which can't be stored in the domain tries.
+// A glob is as specific as its labels without wildcards, like a suffix.
+// Regex and keyword have no depth, they are compared with other rules by priority.
+
+// patternDepth is the depth of candidates matched by regex and keyword.
+const patternDepth = -1
+
+type routerRegex struct {
+	re      *regexp.Regexp
+	matched *routerMatched
+}
+
+// routerKeywords is an Aho-Corasick automaton, all keywords are searched in one pass.
+type routerKeywords struct {
+	nodes    []routerKeywordNode
+	compiled bool
+}
+type routerKeywordNode struct {
+	next    map[byte]int
+	matched []*routerMatched
+	fail    int
+	output  int // the nearest node with matched on the fail chain, 0 if none
+}
+
+// routerGlobNode is a trie of labels, labels with wildcards are matched by path.Match.
+type routerGlobNode struct {
+	next     map[string]*routerGlobNode
+	patterns []routerGlobPattern
+	matched  []*routerMatched // sorted by priority
+}
+type routerGlobPattern struct {
+	node    *routerGlobNode
+	pattern string
+}
+
+///
+
+func (r *router) addRegex(re *regexp.Regexp, matched *routerMatched) {
+	r.regex = append(r.regex, routerRegex{re: re, matched: matched})
+	r.regexAny = nil
+}
+
+func (r *router) addKeyword(keyword string, matched *routerMatched) {
+	if r.keyword == nil {
+		r.keyword = newRouterKeywords()
+	}
+	r.keyword.add(keyword, matched)
+}
+
+func (r *router) addGlob(glob string, matched *routerMatched) {
+	if r.glob == nil {
+		r.glob = new(routerGlobNode)
+	}
+	r.glob.add(domainToSegments(glob), matched)
+}
+
+// compile prepares the matchers, it must be called after all patterns are added.
+func (r *router) compile() {
+	if len(r.regex) > 1 {
+		patterns := make([]string, len(r.regex))
+		for idx, regex := range r.regex {
+			patterns[idx] = "(?:" + regex.re.String() + ")"
+		}
+		// too many regex may exceed the limit of regexp, then each regex is checked
+		r.regexAny, _ = regexp.Compile(strings.Join(patterns, "|"))
+	}
+	if r.keyword != nil {
+		r.keyword.compile()
+	}
+	r.domain.compile()
+	r.domainSuffix.compile()
+}
+
+// collectPatterns adds the candidates matched by regex, keyword and glob, they are ranked as suffixes.
+func (r *router) collectPatterns(name string, cs *routerCandidates) {
+	if len(r.regex) == 0 && r.keyword == nil && r.glob == nil {
+		return
+	}
+	if len(r.regex) > 0 && (r.regexAny == nil || r.regexAny.MatchString(name)) {
+		for _, regex := range r.regex {
+			if regex.re.MatchString(name) {
+				cs.addSuffix(routerCandidate{matched: regex.matched, pattern: "regex", depth: patternDepth})
+			}
+		}
+	}
+	if r.keyword != nil {
+		r.keyword.search(name, func(matched *routerMatched) {
+			cs.addSuffix(routerCandidate{matched: matched, pattern: "keyword", depth: patternDepth})
+		})
+	}
+	if r.glob != nil {
+		r.glob.search(name, 0, func(matched *routerMatched, depth int) {
+			cs.addSuffix(routerCandidate{matched: matched, pattern: "glob", depth: depth})
+		})
+	}
+}
+
+///
+
+func newRouterKeywords() *routerKeywords {
+	return &routerKeywords{nodes: []routerKeywordNode{{}}}
+}
+
+func (k *routerKeywords) add(keyword string, matched *routerMatched) {
+	curr := 0
+	for i := 0; i < len(keyword); i++ {
+		if k.nodes[curr].next == nil {
+			k.nodes[curr].next = make(map[byte]int)
+		}
+		next, found := k.nodes[curr].next[keyword[i]]
+		if !found {
+			next = len(k.nodes)
+			k.nodes = append(k.nodes, routerKeywordNode{})
+			k.nodes[curr].next[keyword[i]] = next
+		}
+		curr = next
+	}
+	k.nodes[curr].matched = insertMatched(k.nodes[curr].matched, matched)
+	k.compiled = false
+}
+
+// compile builds the fail links by BFS.
+func (k *routerKeywords) compile() {
+	queue := []int{}
+	for _, child := range k.nodes[0].next {
+		k.nodes[child].fail = 0
+		k.nodes[child].output = 0
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		for c, child := range k.nodes[curr].next {
+			fail := k.nodes[curr].fail
+			for {
+				if next, found := k.nodes[fail].next[c]; found {
+					fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = k.nodes[fail].fail
+			}
+			k.nodes[child].fail = fail
+			if len(k.nodes[fail].matched) > 0 {
+				k.nodes[child].output = fail
+			} else {
+				k.nodes[child].output = k.nodes[fail].output
+			}
+			queue = append(queue, child)
+		}
+	}
+	k.compiled = true
+}
+
+func (k *routerKeywords) search(name string, fn func(*routerMatched)) {
+	if !k.compiled {
+		return
+	}
+	curr := 0
+	for i := 0; i < len(name); i++ {
+		for {
+			if next, found := k.nodes[curr].next[name[i]]; found {
+				curr = next
+				break
+			}
+			if curr == 0 {
+				break
+			}
+			curr = k.nodes[curr].fail
+		}
+		for out := curr; out != 0; out = k.nodes[out].output {
+			for _, matched := range k.nodes[out].matched {
+				fn(matched)
+			}
+		}
+	}
+}
+
+///
+
+func (node *routerGlobNode) add(segments []string, matched *routerMatched) {
+	curr := node
+	for _, segment := range segments {
+		curr = curr.child(segment)
+	}
+	curr.matched = insertMatched(curr.matched, matched)
+}
+
+func (node *routerGlobNode) child(segment string) *routerGlobNode {
+	if strings.ContainsAny(segment, "*?[") {
+		for _, p := range node.patterns {
+			if p.pattern == segment {
+				return p.node
+			}
+		}
+		next := new(routerGlobNode)
+		node.patterns = append(node.patterns, routerGlobPattern{node: next, pattern: segment})
+		return next
+	}
+	if node.next == nil {
+		node.next = make(map[string]*routerGlobNode)
+	}
+	next, found := node.next[segment]
+	if !found {
+		next = new(routerGlobNode)
+		node.next[segment] = next
+	}
+	return next
+}
+
+// search calls fn with the matched of the full domain, a wildcard doesn't cross labels.
+// The depth is the number of labels matched without wildcards.
+func (node *routerGlobNode) search(name string, depth int, fn func(*routerMatched, int)) {
+	label, rest, found := lastLabel(name)
+	if !found {
+		for _, matched := range node.matched {
+			fn(matched, depth)
+		}
+		return
+	}
+	if next, found := node.next[label]; found {
+		next.search(rest, depth+1, fn)
+	}
+	for _, p := range node.patterns {
+		if ok, _ := path.Match(p.pattern, label); ok {
+			p.node.search(rest, depth, fn)
+		}
+	}
+}
+
+///
+
+// insertMatched keeps the list sorted by priority.
+func insertMatched(list []*routerMatched, matched *routerMatched) []*routerMatched {
+	if slices.Contains(list, matched) {
+		return list
+	}
+	idx, _ := slices.BinarySearchFunc(list, matched.priority, func(m *routerMatched, priority int) int {
+		return m.priority - priority
+	})
+	return slices.Insert(list, idx, matched)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+func newTestRouter(t *testing.T, match string, patterns ...config.Pattern) *router {
+	t.Helper()
+	rules := make([]*config.Rule, len(patterns))
+	for idx, pat := range patterns {
+		rules[idx] = &config.Rule{Pattern: pat, Upstream: config.Upstream{Block: "nxdomain"}}
+	}
+	r := newRouter()
+	if err := r.addRules(context.Background(), &config.Config{Match: match}, rules); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// searchRule returns the priority of the rule used for the name, -1 if none.
+func searchRule(r *router, name string, qtype uint16) int {
+	question := dns.Question{Name: dns.Fqdn(name), Qtype: qtype, Qclass: dns.ClassINET}
+	matched := r.search(context.Background(), question)
+	if matched == nil {
+		return -1
+	}
+	return matched.priority
+}
+
+func TestPatternRanking(t *testing.T) {
+	patterns := []config.Pattern{
+		{Suffix: []string{"example.com"}},
+		{Regex: []string{`^ad[0-9]+\.`}},
+		{Keyword: []string{"tracker"}},
+		{Glob: []string{"*.cdn.*.example.com"}},
+		{Suffix: []string{"cdn.a.example.com"}},
+		{Glob: []string{"*.example.org"}},
+		{Suffix: []string{"example.org"}},
+		{Domain: []string{"ad1.example.com"}},
+		{Suffix: []string{"."}},
+	}
+	longest := newTestRouter(t, "longest", patterns...)
+	first := newTestRouter(t, "first", patterns...)
+
+	tests := []struct {
+		name    string
+		longest int
+		first   int
+	}{
+		{"ad1.example.com", 7, 0},     // a domain is preferred
+		{"ad2.example.com", 0, 0},     // the suffix is defined before the regex
+		{"ad2.example.net", 1, 1},     // the regex is defined before the root
+		{"tracker.example.net", 2, 2}, // the keyword is defined before the root
+		{"tracker.example.com", 0, 0}, // the suffix is defined before the keyword
+		{"x.cdn.y.example.com", 3, 0}, // the glob has 3 literal labels, the suffix has 2
+		{"x.cdn.a.example.com", 4, 0}, // the suffix has 4 labels, the glob has 3
+		{"x.example.org", 5, 5},       // equally specific, the glob is defined earlier
+		{"ad3.cdn.y.example.com", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := searchRule(longest, tt.name, dns.TypeA); got != tt.longest {
+			t.Errorf("longest %s: got rule %d, want %d", tt.name, got, tt.longest)
+		}
+		if got := searchRule(first, tt.name, dns.TypeA); got != tt.first {
+			t.Errorf("first %s: got rule %d, want %d", tt.name, got, tt.first)
+		}
+	}
+}
+
+func TestPatternShadowedReason(t *testing.T) {
+	r := newTestRouter(t, "",
+		config.Pattern{Suffix: []string{"example.com"}},
+		config.Pattern{Regex: []string{`^ad[0-9]+\.`}},
+		config.Pattern{Glob: []string{"*.cdn.*.example.com"}},
+		config.Pattern{Suffix: []string{"cdn.a.example.com"}},
+		config.Pattern{Keyword: []string{"tracker"}, Record: []string{"A"}},
+	)
+
+	tests := []struct {
+		reasons map[int]string
+		kinds   map[int]string
+		name    string
+		matched int
+	}{
+		{map[int]string{1: "defined later"}, map[int]string{0: "suffix", 1: "regex"}, "ad1.example.com", 0},
+		{map[int]string{0: "less specific", 3: "defined later"}, map[int]string{1: "regex", 2: "glob", 3: "suffix"}, "ad1.cdn.a.example.com", 1},
+		{map[int]string{0: "less specific", 2: "less specific"}, map[int]string{2: "glob", 3: "suffix"}, "x.cdn.a.example.com", 3},
+		{map[int]string{4: "defined later"}, map[int]string{0: "suffix", 4: "keyword+record"}, "tracker.example.com", 0},
+	}
+	for _, tt := range tests {
+		question := dns.Question{Name: dns.Fqdn(tt.name), Qtype: dns.TypeA, Qclass: dns.ClassINET}
+		explanation := r.explain(context.Background(), question)
+		if explanation.Matched == nil || explanation.Matched.Rule != tt.matched {
+			t.Errorf("%s: got %+v, want rule %d", tt.name, explanation.Matched, tt.matched)
+			continue
+		}
+		reasons := make(map[int]string)
+		kinds := map[int]string{explanation.Matched.Rule: explanation.Matched.Kind}
+		for _, shadowed := range explanation.Shadowed {
+			reasons[shadowed.Rule] = shadowed.Reason
+			kinds[shadowed.Rule] = shadowed.Kind
+		}
+		for rule, reason := range tt.reasons {
+			if reasons[rule] != reason {
+				t.Errorf("%s: rule %d is %q, want %q", tt.name, rule, reasons[rule], reason)
+			}
+		}
+		for rule, kind := range tt.kinds {
+			if kinds[rule] != kind {
+				t.Errorf("%s: rule %d is a %q, want %q", tt.name, rule, kinds[rule], kind)
+			}
+		}
+	}
+}
+
+func TestPatternRecordTier(t *testing.T) {
+	r := newTestRouter(t, "",
+		config.Pattern{Regex: []string{`^ad\.`}, Record: []string{"AAAA"}},
+		config.Pattern{Keyword: []string{"tracker"}, Record: []string{"A"}},
+		config.Pattern{Glob: []string{"*.*.example.org"}, Record: []string{"A"}},
+		config.Pattern{Regex: []string{`^ad\.`}},
+	)
+	var cs routerCandidates
+	r.collect("ad.tracker.example.org", &cs)
+
+	priorities := func(candidates []routerCandidate) []int {
+		var ps []int
+		for _, c := range candidates {
+			ps = append(ps, c.matched.priority)
+		}
+		slices.Sort(ps)
+		return ps
+	}
+	// patterns of rules with record are ranked with suffixes with record
+	if got := priorities(cs.domainSuffixWithRecord); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Errorf("suffix+record: got %v", got)
+	}
+	if got := priorities(cs.domainSuffix); !slices.Equal(got, []int{3}) {
+		t.Errorf("suffix: got %v", got)
+	}
+}
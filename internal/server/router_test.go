@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+func TestPick(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "adblock.txt")
+	content := "||ads.example.com^\n@@||ok.ads.example.com^\n||imp.example.com^$important\n@@||ok.imp.example.com^\n"
+	if err := os.WriteFile(list, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	readme := []config.Pattern{
+		{Domain: []string{"localhost"}, Record: []string{"A"}},
+		{Suffix: []string{"."}},
+		{Suffix: []string{".cn"}},
+	}
+	tiers := []config.Pattern{
+		{Suffix: []string{"example.com"}},
+		{Suffix: []string{"example.com"}, Record: []string{"AAAA"}},
+		{Domain: []string{"www.example.com"}},
+		{Domain: []string{"www.example.com"}, Record: []string{"AAAA"}},
+		{Suffix: []string{"a.example.com"}, Record: []string{"AAAA"}},
+	}
+	aaaa := []config.Pattern{
+		{Suffix: []string{"."}, Record: []string{"AAAA"}},
+		{Suffix: []string{".cn"}},
+	}
+	exclude := []config.Pattern{
+		{Suffix: []string{"."}},
+		{Suffix: []string{"example.com"}, ExcludeDomain: []string{"www.example.com"}, ExcludeSuffix: []string{"dev.example.com"}},
+	}
+	adblock := []config.Pattern{
+		{Builtin: "adblock", BuiltinList: []string{list}, ExcludeDomain: []string{"x.imp.example.com"}},
+		{Suffix: []string{"."}},
+	}
+
+	tests := []struct {
+		patterns []config.Pattern
+		match    string
+		name     string
+		qtype    uint16
+		want     int
+	}{
+		// the deeper suffix wins, even if it's defined later
+		{readme, "longest", "example.cn", dns.TypeA, 2},
+		{readme, "first", "example.cn", dns.TypeA, 1},
+		{readme, "longest", "localhost", dns.TypeA, 0},
+		{readme, "longest", "localhost", dns.TypeAAAA, 1},
+		{readme, "first", "localhost", dns.TypeA, 0},
+
+		// suffix tiers are compared by priority, unless the longest match is used
+		{aaaa, "", "x.cn", dns.TypeAAAA, 0},
+		{aaaa, "tiered", "x.cn", dns.TypeAAAA, 0},
+		{aaaa, "longest", "x.cn", dns.TypeAAAA, 1},
+		{aaaa, "first", "x.cn", dns.TypeAAAA, 0},
+		{aaaa, "", "x.cn", dns.TypeA, 1},
+		{tiers, "", "www.example.com", dns.TypeAAAA, 3},
+		{tiers, "", "x.a.example.com", dns.TypeAAAA, 0},
+		{readme, "", "example.cn", dns.TypeA, 2},
+
+		// domain+record, domain, suffix+record, suffix
+		{tiers, "longest", "www.example.com", dns.TypeAAAA, 3},
+		{tiers, "longest", "www.example.com", dns.TypeA, 2},
+		{tiers, "first", "www.example.com", dns.TypeAAAA, 0},
+		{tiers, "longest", "x.example.com", dns.TypeAAAA, 0},
+		{tiers, "longest", "x.a.example.com", dns.TypeAAAA, 4},
+		{tiers, "longest", "x.a.example.com", dns.TypeA, 0},
+		{tiers, "first", "x.a.example.com", dns.TypeAAAA, 0},
+
+		// an exclusion skips the rule, then the next matching rule is used
+		{exclude, "longest", "www.example.com", dns.TypeA, 0},
+		{exclude, "longest", "a.dev.example.com", dns.TypeA, 0},
+		{exclude, "longest", "a.example.com", dns.TypeA, 1},
+		{exclude, "first", "a.example.com", dns.TypeA, 0},
+
+		// an exception skips the rule, unless the rule is important
+		{adblock, "longest", "ads.example.com", dns.TypeA, 0},
+		{adblock, "longest", "ok.ads.example.com", dns.TypeA, 1},
+		{adblock, "first", "ok.ads.example.com", dns.TypeA, 1},
+		{adblock, "longest", "ok.imp.example.com", dns.TypeA, 0},
+		{adblock, "longest", "x.imp.example.com", dns.TypeA, 1},
+		{adblock, "first", "x.imp.example.com", dns.TypeA, 1},
+	}
+	for _, tt := range tests {
+		r := newTestRouter(t, tt.match, tt.patterns...)
+		if got := searchRule(r, tt.name, tt.qtype); got != tt.want {
+			t.Errorf("%s %s %s: got rule %d, want %d", tt.match, tt.name, dns.TypeToString[tt.qtype], got, tt.want)
+		}
+	}
+}
+
+func TestZoneOriginRoute(t *testing.T) {
+	rules := []*config.Rule{
+		{Pattern: config.Pattern{Suffix: []string{"a.lan"}}, Upstream: config.Upstream{Zone: "/etc/godns/lan.zone"}},
+		{Pattern: config.Pattern{Suffix: []string{"b.lan"}}, Upstream: config.Upstream{Zone: "/etc/godns/lan.zone"}},
+	}
+	r := newRouter()
+	if err := r.addRules(context.Background(), &config.Config{}, rules); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		if rule.Upstream.ZoneOrigin != "" {
+			t.Errorf("the config is changed: %q", rule.Upstream.ZoneOrigin)
+		}
+	}
+
+	a := r.search(context.Background(), dns.Question{Name: "x.a.lan.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	b := r.search(context.Background(), dns.Question{Name: "x.b.lan.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if a.upstream.ZoneOrigin != "a.lan." || b.upstream.ZoneOrigin != "b.lan." {
+		t.Errorf("origin: %q, %q", a.upstream.ZoneOrigin, b.upstream.ZoneOrigin)
+	}
+	if a.route == b.route {
+		t.Errorf("the same route for different origins: %s", a.route)
+	}
+}
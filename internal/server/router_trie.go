@@ -0,0 +1,171 @@
+package server
+
+import (
+	"slices"
+	"strings"
+)
+
+// routerTrie is a compact trie of reversed domain labels.
+// Domains are collected by add, and built into flat arrays by compile, sorted by their reversed labels.
+// The children of a node are contiguous and sorted by label, so they are found by binary search.
+// Searching works on the domain string directly, without allocation.
+type routerTrie struct {
+	labels  string            // the labels of all nodes
+	entries []routerTrieEntry // pending domains, cleared by compile
+	nodes   []routerTrieNode  // the first node is the root
+	matched []*routerMatched  // the matched of all nodes, each sorted by priority
+}
+type routerTrieEntry struct {
+	matched *routerMatched
+	key     string // reversed labels, each ends with a zero byte
+}
+type routerTrieNode struct {
+	label         uint32 // offset in labels
+	labelLen      uint32
+	children      uint32 // index of the first child in nodes
+	childrenLen   uint32
+	matchedOffset uint32 // offset in matched
+	matchedLen    uint32
+}
+
+///
+
+// add must be called before compile.
+func (t *routerTrie) add(domain string, matched *routerMatched) {
+	t.entries = append(t.entries, routerTrieEntry{matched: matched, key: trieKey(domain)})
+}
+
+// trieKey converts "www.example.com" to "com\x00example\x00www\x00".
+// Zero is less than any byte in labels, so a domain is sorted before its subdomains,
+// and the subdomains of a domain are contiguous.
+func trieKey(domain string) string {
+	name := strings.ToLower(domain)
+	var key strings.Builder
+	key.Grow(len(name) + 1)
+	for {
+		label, rest, found := lastLabel(name)
+		if !found {
+			break
+		}
+		key.WriteString(label)
+		key.WriteByte(0)
+		name = rest
+	}
+	return key.String()
+}
+
+func (t *routerTrie) compile() {
+	if len(t.entries) == 0 {
+		return
+	}
+	slices.SortFunc(t.entries, func(a, b routerTrieEntry) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	// each entry usually has its own node and matched
+	var labels strings.Builder
+	t.nodes = make([]routerTrieNode, 1, len(t.entries)+1)
+	t.matched = make([]*routerMatched, 0, len(t.entries))
+	t.build(0, t.entries, 0, &labels)
+	t.labels = labels.String()
+	t.entries = nil
+}
+
+// build fills the node with the entries, they share the same prefix key[:pos].
+func (t *routerTrie) build(idx int, entries []routerTrieEntry, pos int, labels *strings.Builder) {
+	// entries of the node itself are sorted before others
+	offset := len(t.matched)
+	matched := t.matched[offset:]
+	for len(entries) > 0 && len(entries[0].key) == pos {
+		matched = insertMatched(matched, entries[0].matched)
+		entries = entries[1:]
+	}
+	t.matched = append(t.matched[:offset], matched...)
+	t.nodes[idx].matchedOffset = uint32(offset)
+	t.nodes[idx].matchedLen = uint32(len(matched))
+
+	// the children are added before their subtrees, so they are contiguous
+	children := len(t.nodes)
+	for start := 0; start < len(entries); {
+		label := trieLabel(entries[start].key, pos)
+		end := start + 1
+		for end < len(entries) && trieLabel(entries[end].key, pos) == label {
+			end++
+		}
+		t.nodes = append(t.nodes, routerTrieNode{label: uint32(labels.Len()), labelLen: uint32(len(label))})
+		labels.WriteString(label)
+		start = end
+	}
+	t.nodes[idx].children = uint32(children)
+	t.nodes[idx].childrenLen = uint32(len(t.nodes) - children)
+
+	child := children
+	for start := 0; start < len(entries); child++ {
+		label := trieLabel(entries[start].key, pos)
+		end := start + 1
+		for end < len(entries) && trieLabel(entries[end].key, pos) == label {
+			end++
+		}
+		t.build(child, entries[start:end], pos+len(label)+1, labels)
+		start = end
+	}
+}
+
+func trieLabel(key string, pos int) string {
+	end := strings.IndexByte(key[pos:], 0)
+	return key[pos : pos+end]
+}
+
+///
+
+// collect calls fn with the matched along the name, with the depth of their nodes.
+// The name must be canonical. Without isSuffix, only the node of the full domain is collected.
+func (t *routerTrie) collect(name string, isSuffix bool, fn func(routerCandidate)) {
+	if len(t.nodes) == 0 {
+		return
+	}
+
+	node := &t.nodes[0]
+	depth := 0
+	for {
+		label, rest, found := lastLabel(name)
+		if isSuffix || !found {
+			for _, matched := range t.matched[node.matchedOffset : node.matchedOffset+node.matchedLen] {
+				fn(routerCandidate{matched: matched, depth: depth})
+			}
+		}
+		if !found {
+			break
+		}
+		node = t.child(node, label)
+		if node == nil {
+			break
+		}
+		name = rest
+		depth++
+	}
+}
+
+func (t *routerTrie) child(node *routerTrieNode, label string) *routerTrieNode {
+	children := t.nodes[node.children : node.children+node.childrenLen]
+	idx, found := slices.BinarySearchFunc(children, label, func(n routerTrieNode, label string) int {
+		return strings.Compare(t.labels[n.label:n.label+n.labelLen], label)
+	})
+	if !found {
+		return nil
+	}
+	return &children[idx]
+}
+
+// lastLabel splits "www.example.com." into "com" and "www.example", empty labels are skipped.
+func lastLabel(name string) (string, string, bool) {
+	name = strings.TrimRight(name, ".")
+	if name == "" {
+		return "", "", false
+	}
+	idx := strings.LastIndexByte(name, '.')
+	if idx == -1 {
+		return name, "", true
+	}
+	return name[idx+1:], name[:idx], true
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+// routerNode is the map-based trie replaced by routerTrie, kept for comparison.
+type routerNode struct {
+	next    map[string]*routerNode
+	matched []*routerMatched // sorted by priority
+}
+
+func (node *routerNode) addDomain(domain string, matched *routerMatched) {
+	segments := domainToSegments(domain)
+	curr := node
+	for _, segment := range segments {
+		if curr.next == nil {
+			curr.next = make(map[string]*routerNode)
+		}
+		next, found := curr.next[segment]
+		if !found {
+			next = new(routerNode)
+			curr.next[segment] = next
+		}
+		curr = next
+	}
+	curr.matched = insertMatched(curr.matched, matched)
+}
+
+func (node *routerNode) collect(segments []string, isSuffix bool) []routerCandidate {
+	var candidates []routerCandidate
+	curr := node
+	depth := 0
+	for {
+		if isSuffix || depth == len(segments) {
+			for _, matched := range curr.matched {
+				candidates = append(candidates, routerCandidate{matched: matched, depth: depth})
+			}
+		}
+		if depth == len(segments) || curr.next == nil {
+			break
+		}
+		next, found := curr.next[segments[depth]]
+		if !found {
+			break
+		}
+		curr = next
+		depth++
+	}
+	return candidates
+}
+
+///
+
+// benchSuffixes is about the size of the china list.
+func benchSuffixes() []string {
+	tlds := []string{"cn", "com", "net", "org", "com.cn", "io"}
+	suffixes := make([]string, 0, 65536)
+	for i := range 65536 {
+		suffixes = append(suffixes, fmt.Sprintf("site%x.%s", i*2654435761%1000003, tlds[i%len(tlds)]))
+	}
+	return suffixes
+}
+
+// benchNames are half subdomains of the suffixes, half not matched.
+func benchNames(suffixes []string) []string {
+	names := make([]string, 0, 1024)
+	for i := range 1024 {
+		if i%2 == 0 {
+			names = append(names, "www."+suffixes[i*61%len(suffixes)])
+		} else {
+			names = append(names, fmt.Sprintf("cdn.missing%d.example.com", i))
+		}
+	}
+	return names
+}
+
+func BenchmarkTrieBuild(b *testing.B) {
+	suffixes := benchSuffixes()
+	matched := &routerMatched{}
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			node := new(routerNode)
+			for _, suffix := range suffixes {
+				node.addDomain(suffix, matched)
+			}
+		}
+	})
+	b.Run("sorted", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			t := new(routerTrie)
+			for _, suffix := range suffixes {
+				t.add(suffix, matched)
+			}
+			t.compile()
+		}
+	})
+}
+
+func BenchmarkTrieLookup(b *testing.B) {
+	suffixes := benchSuffixes()
+	names := benchNames(suffixes)
+	matched := &routerMatched{}
+
+	node := new(routerNode)
+	t := new(routerTrie)
+	for _, suffix := range suffixes {
+		node.addDomain(suffix, matched)
+		t.add(suffix, matched)
+	}
+	t.compile()
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		found := 0
+		for i := range b.N {
+			found += len(node.collect(domainToSegments(names[i%len(names)]), true))
+		}
+		_ = found
+	})
+	b.Run("sorted", func(b *testing.B) {
+		b.ReportAllocs()
+		found := 0
+		for i := range b.N {
+			t.collect(names[i%len(names)], true, func(routerCandidate) { found++ })
+		}
+		_ = found
+	})
+}
+
+func TestRouterSearchAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the pool drops items with the race detector")
+	}
+	suffixes := benchSuffixes()
+	r := newTestRouter(t, "",
+		config.Pattern{Suffix: []string{"."}},
+		config.Pattern{Suffix: suffixes},
+		config.Pattern{Domain: []string{"www." + suffixes[0]}, Record: []string{"A"}},
+	)
+	ctx := context.Background()
+	for _, name := range benchNames(suffixes)[:4] {
+		question := dns.Question{Name: dns.Fqdn(name), Qtype: dns.TypeA, Qclass: dns.ClassINET}
+		if allocs := testing.AllocsPerRun(100, func() { r.search(ctx, question) }); allocs != 0 {
+			t.Errorf("%s: %v allocations", name, allocs)
+		}
+	}
+}
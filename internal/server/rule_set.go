@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+	"github.com/dhcmrlchtdj/godns/internal/util"
+)
+
+const (
+	ruleSetDefaultRefresh = 24 * time.Hour
+	ruleSetMinBackoff     = 10 * time.Second
+	ruleSetMaxBackoff     = time.Hour
+)
+
+// routerRuleSet is a remote rule list.
+// It's downloaded periodically, and swapped into the router as a whole.
+type routerRuleSet struct {
+	conf    *config.RuleSet
+	matched *routerMatched
+	remote  *util.RemoteList
+	data    atomic.Pointer[router]
+	loaded  atomic.Pointer[routerRuleSetLoaded]
+	name    string
+}
+
+// routerRuleSetLoaded is the last loaded list, it's kept to rebuild the rule set for a reloaded config.
+type routerRuleSetLoaded struct {
+	fetched time.Time // the zero time if the list is from the cache
+	filters []util.FilterRule
+}
+
+func (r *router) addRuleSet(ctx context.Context, name string, conf *config.RuleSet, matched *routerMatched) {
+	zerolog.Ctx(ctx).
+		Trace().
+		Str("module", "server.rule_set").
+		Int("priority", matched.priority).
+		Str("name", name).
+		Str("url", conf.Url).
+		Msg("added")
+
+	r.ruleSets = append(r.ruleSets, &routerRuleSet{name: name, conf: conf, matched: matched})
+}
+
+// refreshRuleSets downloads rule sets in background, until the ctx is done.
+// The lists are cached in the cacheDir, if it's set.
+func (r *router) refreshRuleSets(ctx context.Context, cacheDir string) {
+	for _, ruleSet := range r.ruleSets {
+		go ruleSet.refresh(ctx, cacheDir)
+	}
+}
+
+func (set *routerRuleSet) refresh(ctx context.Context, cacheDir string) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("module", "server.rule_set").
+		Str("name", set.name).
+		Logger()
+
+	interval := ruleSetDefaultRefresh
+	if set.conf.Refresh != "" {
+		interval, _ = time.ParseDuration(set.conf.Refresh)
+	}
+	remote := set.remoteList(ctx, cacheDir)
+
+	// use the cached copy until the list is revalidated
+	var next time.Duration
+	if loaded := set.loaded.Load(); loaded == nil {
+		set.loadCache(ctx, remote)
+	} else if !loaded.fetched.IsZero() {
+		// inherited from the old config, keep its schedule
+		next = max(interval-time.Since(loaded.fetched), 0)
+	}
+
+	backoff := ruleSetMinBackoff
+	for {
+		timer := time.NewTimer(next)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		next = interval
+		if err := set.load(ctx, remote); err != nil {
+			logger.Error().Err(err).Dur("retry", backoff).Msg("failed to load rule set")
+			next = backoff
+			backoff = min(backoff*2, interval, ruleSetMaxBackoff)
+		} else {
+			backoff = ruleSetMinBackoff
+		}
+	}
+}
+
+// remoteList is shared by loading the cache and refreshing, so the cached validators are used.
+func (set *routerRuleSet) remoteList(ctx context.Context, cacheDir string) *util.RemoteList {
+	if set.remote == nil {
+		set.remote = util.MakeRemoteList(ctx, set.conf.Url, set.conf.Proxy, cacheDir)
+	}
+	return set.remote
+}
+
+// loadCachedRuleSets loads the cached copies of rule sets, without downloading.
+// The rule sets already loaded are skipped.
+func (r *router) loadCachedRuleSets(ctx context.Context, cacheDir string) {
+	for _, set := range r.ruleSets {
+		if set.loaded.Load() == nil {
+			set.loadCache(ctx, set.remoteList(ctx, cacheDir))
+		}
+	}
+}
+
+// inheritRuleSets reuses the lists loaded by the old router, if they have the same source.
+func (r *router) inheritRuleSets(ctx context.Context, old *router) {
+	for _, set := range r.ruleSets {
+		if set.loaded.Load() != nil {
+			continue
+		}
+		for _, oldSet := range old.ruleSets {
+			if oldSet.conf.Url != set.conf.Url || oldSet.conf.Format != set.conf.Format {
+				continue
+			}
+			if loaded := oldSet.loaded.Load(); loaded != nil {
+				set.store(ctx, loaded, "reload")
+				break
+			}
+		}
+	}
+}
+
+func (set *routerRuleSet) loadCache(ctx context.Context, remote *util.RemoteList) {
+	filters, err := remote.LoadCache(set.conf.Format)
+	if err != nil {
+		zerolog.Ctx(ctx).
+			Debug().
+			Str("module", "server.rule_set").
+			Str("name", set.name).
+			Err(err).
+			Msg("failed to load cache")
+		return
+	}
+	if filters != nil {
+		set.store(ctx, &routerRuleSetLoaded{filters: filters}, "cache")
+	}
+}
+
+func (set *routerRuleSet) load(ctx context.Context, remote *util.RemoteList) error {
+	filters, err := remote.Fetch(set.conf.Format)
+	if errors.Is(err, util.ErrRuleListNotModified) {
+		if loaded := set.loaded.Load(); loaded != nil {
+			set.loaded.Store(&routerRuleSetLoaded{fetched: time.Now(), filters: loaded.filters})
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	set.store(ctx, &routerRuleSetLoaded{fetched: time.Now(), filters: filters}, "remote")
+	return nil
+}
+
+func (set *routerRuleSet) store(ctx context.Context, loaded *routerRuleSetLoaded, from string) {
+	data := newRouter()
+	for idx := range loaded.filters {
+		data.addFilter(ctx, &loaded.filters[idx], set.matched)
+	}
+	data.compile()
+	set.data.Store(data)
+	set.loaded.Store(loaded)
+
+	zerolog.Ctx(ctx).
+		Info().
+		Str("module", "server.rule_set").
+		Str("name", set.name).
+		Str("from", from).
+		Int("rules", len(loaded.filters)).
+		Msg("rule set loaded")
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+// routerSchedule is the time when a rule is active.
+// If the end is before the start, the range crosses midnight, and it belongs to the weekday of the start.
+type routerSchedule struct {
+	loc      *time.Location
+	weekdays []time.Weekday // empty means every day
+	start    time.Duration  // since midnight
+	end      time.Duration  // same as the start means all day
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseSchedules(schedules []*config.Schedule) []*routerSchedule {
+	var parsed []*routerSchedule
+	for _, conf := range schedules {
+		schedule := &routerSchedule{loc: time.Local}
+		if conf.Timezone != "" {
+			schedule.loc, _ = time.LoadLocation(conf.Timezone)
+		}
+		for _, day := range conf.Weekday {
+			schedule.weekdays = append(schedule.weekdays, weekdays[strings.ToLower(day)[:3]])
+		}
+		schedule.start, _ = config.ParseClock(conf.Start)
+		schedule.end, _ = config.ParseClock(conf.End)
+		parsed = append(parsed, schedule)
+	}
+	return parsed
+}
+
+func (s *routerSchedule) active(now time.Time) bool {
+	t := now.In(s.loc)
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+	switch {
+	case s.start == s.end:
+		return s.onDay(day)
+	case s.start < s.end:
+		return s.onDay(day) && clock >= s.start && clock < s.end
+	case clock >= s.start:
+		return s.onDay(day)
+	case clock < s.end:
+		return s.onDay((day + 6) % 7)
+	default:
+		return false
+	}
+}
+
+func (s *routerSchedule) onDay(day time.Weekday) bool {
+	return len(s.weekdays) == 0 || slices.Contains(s.weekdays, day)
+}
+
+// nextBoundary returns the next time the schedule may change, the start, the end or midnight.
+func (s *routerSchedule) nextBoundary(now time.Time) time.Time {
+	t := now.In(s.loc)
+	var next time.Time
+	for d := range 2 {
+		for _, clock := range []time.Duration{0, s.start, s.end} {
+			boundary := time.Date(t.Year(), t.Month(), t.Day()+d, 0, 0, 0, 0, s.loc).Add(clock)
+			if boundary.After(now) && (next.IsZero() || boundary.Before(next)) {
+				next = boundary
+			}
+		}
+	}
+	return next
+}
+
+///
+
+// matchSchedule checks whether the rule is active.
+func (m *routerMatched) matchSchedule(now time.Time) bool {
+	if len(m.schedules) == 0 {
+		return true
+	}
+	for _, schedule := range m.schedules {
+		if schedule.active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeTime returns the first time the rule is active, searched by the boundaries in the next days.
+func (m *routerMatched) activeTime(now time.Time) (time.Time, bool) {
+	t := now
+	for range 64 {
+		if m.matchSchedule(t) {
+			return t, true
+		}
+		var next time.Time
+		for _, schedule := range m.schedules {
+			if boundary := schedule.nextBoundary(t); next.IsZero() || boundary.Before(next) {
+				next = boundary
+			}
+		}
+		t = next
+	}
+	return now, false
+}
+
+// nextScheduleBoundary returns the zero time if no rule with schedules matches the name.
+func (r *router) nextScheduleBoundary(question dns.Question, now time.Time) time.Time {
+	if len(r.scheduleRules) == 0 {
+		return time.Time{}
+	}
+	name := strings.TrimSuffix(dns.CanonicalName(question.Name), ".")
+	var cs routerCandidates
+	r.collect(name, &cs)
+
+	var next time.Time
+	for _, candidates := range [][]routerCandidate{cs.domainWithRecord, cs.domain, cs.domainSuffixWithRecord, cs.domainSuffix} {
+		for _, c := range candidates {
+			for _, schedule := range c.matched.schedules {
+				boundary := schedule.nextBoundary(now)
+				if next.IsZero() || boundary.Before(next) {
+					next = boundary
+				}
+			}
+		}
+	}
+	return next
+}
+
+// limitTtl makes the answer expire before the schedule changes.
+func limitTtl(msg *dns.Msg, boundary time.Time) {
+	if boundary.IsZero() {
+		return
+	}
+	ttl := uint32(math.Ceil(max(time.Until(boundary).Seconds(), 0)))
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range rrs {
+			if rr.Header().Ttl > ttl {
+				rr.Header().Ttl = ttl
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+func TestNextScheduleBoundary(t *testing.T) {
+	rules := []*config.Rule{
+		{Pattern: config.Pattern{Suffix: []string{"game.com"}}, Schedule: []*config.Schedule{{Start: "09:00", End: "17:00"}}, Upstream: config.Upstream{Block: "nxdomain"}},
+		{Pattern: config.Pattern{Suffix: []string{"."}}, Upstream: config.Upstream{Udp: "127.0.0.1:53"}},
+	}
+	r := newRouter()
+	if err := r.addRules(context.Background(), &config.Config{}, rules); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		boundary time.Time
+	}{
+		{"www.game.com.", time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)},
+		{"game.com.", time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)},
+		{"example.com.", time.Time{}},
+	}
+	for _, tt := range tests {
+		question := dns.Question{Name: tt.name, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+		if got := r.nextScheduleBoundary(question, now); !got.Equal(tt.boundary) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.boundary)
+		}
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	overnight := parseSchedules([]*config.Schedule{{Weekday: []string{"thu"}, Start: "21:00", End: "07:00", Timezone: "UTC"}})[0]
+	tokyo := parseSchedules([]*config.Schedule{{Start: "09:00", End: "17:00", Timezone: "Asia/Tokyo"}})[0]
+	saturday := parseSchedules([]*config.Schedule{{Weekday: []string{"sat"}, Start: "08:00", End: "08:00", Timezone: "Asia/Tokyo"}})[0]
+	allDay := parseSchedules([]*config.Schedule{{Start: "00:00", End: "00:00", Timezone: "UTC"}})[0]
+	newYork := time.FixedZone("EST", -5*60*60)
+
+	// 2024-01-04 is a Thursday
+	tests := []struct {
+		schedule *routerSchedule
+		now      time.Time
+		active   bool
+	}{
+		{overnight, time.Date(2024, 1, 4, 20, 59, 0, 0, time.UTC), false},
+		{overnight, time.Date(2024, 1, 4, 21, 0, 0, 0, time.UTC), true},
+		{overnight, time.Date(2024, 1, 5, 3, 0, 0, 0, time.UTC), true}, // Friday, started on Thursday
+		{overnight, time.Date(2024, 1, 5, 7, 0, 0, 0, time.UTC), false},
+		{overnight, time.Date(2024, 1, 5, 22, 0, 0, 0, time.UTC), false},
+		{overnight, time.Date(2024, 1, 6, 3, 0, 0, 0, time.UTC), false}, // Saturday, started on Friday
+		{overnight, time.Date(2024, 1, 4, 23, 0, 0, 0, newYork), true},  // Friday 04:00 in UTC
+
+		// the clock is in the timezone of the schedule
+		{tokyo, time.Date(2024, 1, 5, 1, 0, 0, 0, time.UTC), true},
+		{tokyo, time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC), false},
+		{tokyo, time.Date(2024, 1, 4, 20, 0, 0, 0, newYork), true},
+
+		// the same start and end means all day
+		{saturday, time.Date(2024, 1, 5, 14, 0, 0, 0, time.UTC), false},
+		{saturday, time.Date(2024, 1, 5, 16, 0, 0, 0, time.UTC), true},
+		{allDay, time.Date(2024, 1, 5, 16, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.active(tt.now); got != tt.active {
+			t.Errorf("%+v at %v: got %v, want %v", tt.schedule, tt.now, got, tt.active)
+		}
+	}
+}
+
+func TestScheduleActiveTime(t *testing.T) {
+	tests := []struct {
+		now       time.Time
+		want      time.Time
+		schedules []*config.Schedule
+	}{
+		{
+			time.Date(2024, 1, 4, 22, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 4, 22, 0, 0, 0, time.UTC),
+			[]*config.Schedule{{Weekday: []string{"thu"}, Start: "21:00", End: "07:00", Timezone: "UTC"}},
+		},
+		{
+			time.Date(2024, 1, 5, 8, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 11, 21, 0, 0, 0, time.UTC),
+			[]*config.Schedule{{Weekday: []string{"thu"}, Start: "21:00", End: "07:00", Timezone: "UTC"}},
+		},
+		{
+			time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), // 09:00 in Tokyo
+			[]*config.Schedule{{Start: "09:00", End: "17:00", Timezone: "Asia/Tokyo"}},
+		},
+		{
+			time.Date(2024, 1, 5, 8, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC), // the earlier of the schedules
+			[]*config.Schedule{
+				{Weekday: []string{"thu"}, Start: "21:00", End: "07:00", Timezone: "UTC"},
+				{Weekday: []string{"fri"}, Start: "12:00", End: "13:00", Timezone: "UTC"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		m := &routerMatched{schedules: parseSchedules(tt.schedules)}
+		got, found := m.activeTime(tt.now)
+		if !found || !got.Equal(tt.want) {
+			t.Errorf("%v: got %v %v, want %v", tt.now, got, found, tt.want)
+		}
+	}
+}
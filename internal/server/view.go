@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+)
+
+// dnsView is a set of rules with its own local records.
+// The default view has no name, it's used if no other view is selected.
+type dnsView struct {
+	router  *router
+	reverse reverseIndex
+	name    string
+	clients []netip.Prefix
+	listen  []string
+}
+
+// dnsViews is the routing of the server, built from a config.
+// It's built off to the side, and swapped into the server as a whole, so queries never see a partial one.
+type dnsViews struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	conf    *config.Config
+	main    *dnsView
+	views   []*dnsView
+	refresh sync.Once
+}
+
+func newView(ctx context.Context, conf *config.Config, name string, rules []*config.Rule) (*dnsView, error) {
+	r := newRouter()
+	if err := r.addRules(ctx, conf, rules); err != nil {
+		return nil, err
+	}
+	view := &dnsView{
+		name:    name,
+		router:  r,
+		reverse: newReverseIndex(ctx, rules),
+	}
+
+	zerolog.Ctx(ctx).
+		Debug().
+		Str("module", "server.view").
+		Str("view", name).
+		Int("rules", len(rules)).
+		Msg("view loaded")
+	return view, nil
+}
+
+func newViews(ctx context.Context, conf *config.Config) (*dnsViews, error) {
+	main, err := newView(ctx, conf, "", conf.Rule)
+	if err != nil {
+		return nil, err
+	}
+	views := &dnsViews{conf: conf, main: main}
+	for _, viewConf := range conf.View {
+		view, err := newView(ctx, conf, viewConf.Name, viewConf.Rule)
+		if err != nil {
+			return nil, errors.WithMessage(err, viewConf.Name)
+		}
+		view.clients = parseClients(conf.Client, viewConf.Client)
+		view.listen = viewConf.Listen
+		views.views = append(views.views, view)
+	}
+	views.ctx, views.cancel = context.WithCancel(ctx)
+	return views, nil
+}
+
+// all returns the default view and other views.
+func (vs *dnsViews) all() []*dnsView {
+	return append([]*dnsView{vs.main}, vs.views...)
+}
+
+// refreshRuleSets downloads rule sets in background, until the views are swapped out.
+func (vs *dnsViews) refreshRuleSets() {
+	vs.refresh.Do(func() {
+		for _, view := range vs.all() {
+			view.router.refreshRuleSets(vs.ctx, vs.conf.CacheDir)
+		}
+	})
+}
+
+// loadRuleSets fills the rule sets before the views are used.
+// The lists of the old views are reused, others are loaded from the cache.
+func (vs *dnsViews) loadRuleSets(old *dnsViews) {
+	for _, view := range vs.all() {
+		if old != nil {
+			for _, oldView := range old.all() {
+				view.router.inheritRuleSets(vs.ctx, oldView.router)
+			}
+		}
+		view.router.loadCachedRuleSets(vs.ctx, vs.conf.CacheDir)
+	}
+}
+
+// listenOf maps the listen addresses to their views.
+func (vs *dnsViews) listenOf() map[string]string {
+	listen := make(map[string]string)
+	for _, view := range vs.views {
+		for _, addr := range view.listen {
+			listen[addr] = view.name
+		}
+	}
+	return listen
+}
+
+// swapViews replaces the routing of the server, the old one stops refreshing.
+func (s *DnsServer) swapViews(views *dnsViews) {
+	if old := s.views.Swap(views); old != nil {
+		old.cancel()
+	}
+}
+
+// selectView returns the view of the listener, or the first view of the client.
+func (vs *dnsViews) selectView(ctx context.Context, listen string) *dnsView {
+	if listen != "" {
+		for _, view := range vs.views {
+			for _, addr := range view.listen {
+				if addr == listen {
+					return view
+				}
+			}
+		}
+	}
+	client := clientAddrOf(ctx)
+	for _, view := range vs.views {
+		if containsClient(view.clients, client) {
+			return view
+		}
+	}
+	return vs.main
+}
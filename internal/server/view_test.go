@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/phuslu/shardmap"
+
+	"github.com/dhcmrlchtdj/godns/internal/config"
+	"github.com/dhcmrlchtdj/godns/internal/util"
+)
+
+type testResponseWriter struct {
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *testResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+func (w *testResponseWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *testResponseWriter) WriteMsg(msg *dns.Msg) error { w.msg = msg; return nil }
+func (w *testResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *testResponseWriter) Close() error                { return nil }
+func (w *testResponseWriter) TsigStatus() error           { return nil }
+func (w *testResponseWriter) TsigTimersOnly(bool)         {}
+func (w *testResponseWriter) Hijack()                     {}
+
+func writeTestConfig(t *testing.T, file string, ip string) {
+	t.Helper()
+	conf := fmt.Sprintf(`{
+		"rule_set": { "ads": { "url": "http://127.0.0.1:1/ads.txt", "format": "adblock" } },
+		"rule": [
+			{ "pattern": { "domain": ["a.test"], "record": "A" }, "upstream": { "ipv4": %q } },
+			{ "pattern": { "rule_set": ["ads"] }, "upstream": { "block": "nxdomain" } }
+		],
+		"view": [
+			{
+				"name": "lan",
+				"client": ["10.0.0.0/8"],
+				"rule": [{ "pattern": { "domain": ["a.test"], "record": "A" }, "upstream": { "ipv4": "192.0.2.10" } }]
+			}
+		]
+	}`, ip)
+	if err := os.WriteFile(file, []byte(conf), 0o600); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestViewsConcurrent queries while the views are swapped, reloaded and their rule sets are updated.
+func TestViewsConcurrent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, file, "192.0.2.1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &DnsServer{
+		ctx:        ctx,
+		cache:      shardmap.New[string, *deferredAnswer](64),
+		configFile: file,
+	}
+	if err := s.Config.ReadConfigFile(file); err != nil {
+		t.Fatal(err)
+	}
+	s.SetupRouter()
+	defer s.views.Load().cancel()
+
+	clients := []net.Addr{
+		&net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 5353},
+		&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5353},
+	}
+	main := []string{"192.0.2.1", "192.0.2.2"}
+	lan := []string{"192.0.2.10"}
+
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				client := clients[(worker+i)%len(clients)]
+				request := new(dns.Msg).SetQuestion("a.test.", dns.TypeA)
+				if i%2 == 0 {
+					request.SetQuestion(fmt.Sprintf("x%d.ads.test.", i), dns.TypeA)
+				}
+				w := &testResponseWriter{remote: client}
+				s.handleRequest(w, request, "")
+				if i%2 == 0 {
+					continue
+				}
+				want := main
+				if client == clients[1] {
+					want = lan
+				}
+				if w.msg == nil || len(w.msg.Answer) != 1 {
+					t.Errorf("a.test from %s: %v", client, w.msg)
+					continue
+				}
+				if ip := w.msg.Answer[0].(*dns.A).A.String(); !slices.Contains(want, ip) {
+					t.Errorf("a.test from %s: got %s, want %v", client, ip, want)
+				}
+
+				// the view may be swapped out during the query
+				reply := new(dns.Msg).SetReply(request)
+				s.query(ctx, s.views.Load().main, reply)
+			}
+		}()
+	}
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := range 20 {
+			writeTestConfig(t, file, main[i%2])
+			if err := s.Reload(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			conf := new(config.Config)
+			if err := conf.ReadConfigFile(file); err != nil {
+				// the file may be partially written by the reload
+				continue
+			}
+			views, err := newViews(ctx, conf)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			views.loadRuleSets(s.views.Load())
+			s.swapViews(views)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		loaded := &routerRuleSetLoaded{filters: []util.FilterRule{{Domain: "ads.test"}}}
+		for range 50 {
+			for _, view := range s.views.Load().all() {
+				for _, set := range view.router.ruleSets {
+					set.store(ctx, loaded, "test")
+				}
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// FileWatcher reports whether any of the watched files changed since the last check.
+// Files are stat-ed at most once per interval.
+type FileWatcher struct {
+	checked  time.Time
+	paths    []string
+	stamps   []fileStamp
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+func MakeFileWatcher(interval time.Duration, paths ...string) *FileWatcher {
+	watcher := FileWatcher{
+		paths:    paths,
+		stamps:   make([]fileStamp, len(paths)),
+		interval: interval,
+	}
+	for idx, path := range paths {
+		watcher.stamps[idx] = statFile(path)
+	}
+	watcher.checked = time.Now()
+	return &watcher
+}
+
+func (w *FileWatcher) Changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if time.Since(w.checked) < w.interval {
+		return false
+	}
+	w.checked = time.Now()
+
+	changed := false
+	for idx, path := range w.paths {
+		stamp := statFile(path)
+		if stamp != w.stamps[idx] {
+			w.stamps[idx] = stamp
+			changed = true
+		}
+	}
+	return changed
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
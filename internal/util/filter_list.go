@@ -0,0 +1,173 @@
+package util
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// FilterRule is a rule of AdGuard/uBlock-style DNS filter lists, or hosts-style blocklists.
+type FilterRule struct {
+	Regex          *regexp.Regexp
+	Keyword        string // the domain contains the keyword
+	Glob           string // *.example.com, a wildcard doesn't cross labels
+	Domain         string
+	Records        []uint16 // from $dnstype=A|AAAA
+	ExcludeRecords []uint16 // from $dnstype=~A
+	Exact          bool     // |example.com^ and hosts-style entries, otherwise subdomains are matched
+	Allow          bool     // @@||example.com^
+	Important      bool     // $important
+}
+
+// ParseFilterList returns the supported rules and the number of unsupported rules.
+func ParseFilterList(r io.Reader) ([]FilterRule, int, error) {
+	var rules []FilterRule
+	skipped := 0
+
+	buf := bufio.NewScanner(r)
+	for buf.Scan() {
+		line := strings.TrimSpace(buf.Text())
+		if line == "" || line[0] == '!' || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+
+		if hosts, ok := parseHostsLine(line); ok {
+			rules = append(rules, hosts...)
+			continue
+		}
+
+		rule, ok := parseFilterRule(line)
+		if !ok {
+			skipped++
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if err := buf.Err(); err != nil {
+		return nil, skipped, errors.WithStack(err)
+	}
+
+	return rules, skipped, nil
+}
+
+// names which should not be blocked in hosts-style blocklists
+var hostsIgnored = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"0.0.0.0":               true,
+}
+
+func parseHostsLine(line string) ([]FilterRule, bool) {
+	if idx := strings.IndexByte(line, '#'); idx >= 0 {
+		line = line[:idx]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return nil, false
+	}
+	var rules []FilterRule
+	for _, name := range fields[1:] {
+		name = strings.ToLower(name)
+		if hostsIgnored[name] {
+			continue
+		}
+		rules = append(rules, FilterRule{Domain: name, Exact: true})
+	}
+	return rules, true
+}
+
+func parseFilterRule(line string) (FilterRule, bool) {
+	var rule FilterRule
+
+	if strings.HasPrefix(line, "@@") {
+		rule.Allow = true
+		line = line[2:]
+	}
+
+	var pattern, modifiers string
+	if len(line) > 1 && line[0] == '/' {
+		end := strings.LastIndexByte(line, '/')
+		if end == 0 {
+			return rule, false
+		}
+		pattern, modifiers = line[:end+1], line[end+1:]
+		if modifiers != "" && modifiers[0] != '$' {
+			return rule, false
+		}
+		modifiers = strings.TrimPrefix(modifiers, "$")
+	} else if idx := strings.LastIndexByte(line, '$'); idx >= 0 {
+		pattern, modifiers = line[:idx], line[idx+1:]
+	} else {
+		pattern = line
+	}
+
+	if modifiers != "" {
+		for _, modifier := range strings.Split(modifiers, ",") {
+			if modifier == "important" {
+				rule.Important = true
+			} else if types, found := strings.CutPrefix(modifier, "dnstype="); found {
+				for _, t := range strings.Split(types, "|") {
+					exclude := strings.HasPrefix(t, "~")
+					recordType, found := dns.StringToType[strings.ToUpper(strings.TrimPrefix(t, "~"))]
+					if !found {
+						return rule, false
+					}
+					if exclude {
+						rule.ExcludeRecords = append(rule.ExcludeRecords, recordType)
+					} else {
+						rule.Records = append(rule.Records, recordType)
+					}
+				}
+			} else {
+				// $client, $denyallow, $dnsrewrite, etc. are not supported
+				return rule, false
+			}
+		}
+	}
+
+	if len(pattern) > 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/' {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return rule, false
+		}
+		rule.Regex = re
+		return rule, true
+	}
+
+	if strings.HasPrefix(pattern, "||") {
+		pattern = pattern[2:]
+	} else if strings.HasPrefix(pattern, "|") {
+		rule.Exact = true
+		pattern = pattern[1:]
+	}
+	pattern = strings.TrimSuffix(pattern, "|")
+	pattern = strings.TrimSuffix(pattern, "^")
+	pattern = strings.ToLower(pattern)
+	if !isPlainDomain(pattern) {
+		return rule, false
+	}
+	rule.Domain = pattern
+	return rule, true
+}
+
+// isPlainDomain rejects wildcards, paths and other URL patterns.
+func isPlainDomain(domain string) bool {
+	if domain == "" {
+		return false
+	}
+	for _, c := range domain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package util
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrGeositeFormat   = errors.New("invalid geosite file")
+	ErrGeositeCategory = errors.New("unknown geosite category")
+)
+
+// Geosite is the geosite.dat of V2Ray/Xray.
+//
+//	message GeoSiteList { repeated GeoSite entry = 1; }
+//	message GeoSite { string country_code = 1; repeated Domain domain = 2; }
+//	message Domain { Type type = 1; string value = 2; repeated Attribute attribute = 3; }
+//	message Attribute { string key = 1; oneof typed_value { bool bool_value = 2; int64 int_value = 3; } }
+type Geosite struct {
+	categories map[string][]byte // raw GeoSite messages
+}
+
+// domain types of geosite
+const (
+	geositePlain  = 0 // keyword
+	geositeRegex  = 1
+	geositeDomain = 2 // the domain and its subdomains
+	geositeFull   = 3
+)
+
+func LoadGeosite(path string) (*Geosite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ParseGeosite(data)
+}
+
+// ParseGeosite indexes the categories, domains are decoded on demand.
+func ParseGeosite(data []byte) (*Geosite, error) {
+	geosite := &Geosite{categories: make(map[string][]byte)}
+	err := protoFields(data, func(field int, value []byte) error {
+		if field != 1 {
+			return nil
+		}
+		var code string
+		err := protoFields(value, func(field int, v []byte) error {
+			if field == 1 {
+				code = strings.ToLower(string(v))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		geosite.categories[code] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return geosite, nil
+}
+
+// Rules returns the rules of the category.
+// "google@cn" only keeps domains with the attribute "cn", "google@!cn" keeps domains without it.
+func (g *Geosite) Rules(category string) ([]FilterRule, error) {
+	name, attr, _ := strings.Cut(strings.ToLower(category), "@")
+	negate := false
+	if strings.HasPrefix(attr, "!") {
+		negate = true
+		attr = attr[1:]
+	}
+
+	site, found := g.categories[name]
+	if !found {
+		return nil, errors.Wrap(ErrGeositeCategory, name)
+	}
+
+	var rules []FilterRule
+	err := protoFields(site, func(field int, value []byte) error {
+		if field != 2 {
+			return nil
+		}
+		domainType, domain, attrs, err := parseGeositeDomain(value)
+		if err != nil {
+			return err
+		}
+		if attr != "" && slices.Contains(attrs, attr) == negate {
+			return nil
+		}
+		rule, err := geositeRule(domainType, domain)
+		if err != nil {
+			return errors.WithMessage(err, category)
+		}
+		rules = append(rules, rule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseGeositeDomain(data []byte) (uint64, string, []string, error) {
+	var domainType uint64
+	var domain string
+	var attrs []string
+	err := protoFields(data, func(field int, value []byte) error {
+		switch field {
+		case 1:
+			v, n := protoVarint(value)
+			if n == 0 {
+				return ErrGeositeFormat
+			}
+			domainType = v
+		case 2:
+			domain = string(value)
+		case 3:
+			return protoFields(value, func(field int, v []byte) error {
+				if field == 1 {
+					attrs = append(attrs, strings.ToLower(string(v)))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return domainType, domain, attrs, err
+}
+
+func geositeRule(domainType uint64, domain string) (FilterRule, error) {
+	switch domainType {
+	case geositePlain:
+		return FilterRule{Keyword: strings.ToLower(domain)}, nil
+	case geositeRegex:
+		re, err := regexp.Compile(domain)
+		if err != nil {
+			return FilterRule{}, errors.WithStack(err)
+		}
+		return FilterRule{Regex: re}, nil
+	case geositeDomain:
+		return FilterRule{Domain: strings.ToLower(domain)}, nil
+	case geositeFull:
+		return FilterRule{Domain: strings.ToLower(domain), Exact: true}, nil
+	default:
+		return FilterRule{}, errors.Wrapf(ErrGeositeFormat, "domain type %d", domainType)
+	}
+}
+
+///
+
+// protoFields iterates the fields of a protobuf message.
+// The value is the raw bytes for length-delimited fields, or the encoded varint for varint fields.
+func protoFields(data []byte, fn func(field int, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := protoVarint(data)
+		if n == 0 {
+			return ErrGeositeFormat
+		}
+		data = data[n:]
+
+		field, wireType := int(key>>3), key&7
+		var value []byte
+		switch wireType {
+		case 0: // varint
+			_, n := protoVarint(data)
+			if n == 0 {
+				return ErrGeositeFormat
+			}
+			value, data = data[:n], data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return ErrGeositeFormat
+			}
+			value, data = data[:8], data[8:]
+		case 2: // length-delimited
+			size, n := protoVarint(data)
+			if n == 0 || uint64(len(data)-n) < size {
+				return ErrGeositeFormat
+			}
+			data = data[n:]
+			value, data = data[:size], data[size:]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return ErrGeositeFormat
+			}
+			value, data = data[:4], data[4:]
+		default:
+			return ErrGeositeFormat
+		}
+
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoVarint returns the value and the number of bytes read, 0 means invalid.
+func protoVarint(data []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		v |= uint64(data[i]&0x7f) << (7 * i)
+		if data[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,176 @@
+package util
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// protoBytes encodes a length-delimited field, the length must fit in one byte.
+func protoBytes(field byte, value ...[]byte) []byte {
+	data := slices.Concat(value...)
+	return append([]byte{field<<3 | 2, byte(len(data))}, data...)
+}
+
+func geositeDomainOf(domainType byte, domain string, attrs ...string) []byte {
+	fields := [][]byte{{1 << 3, domainType}, protoBytes(2, []byte(domain))}
+	for _, attr := range attrs {
+		// bool_value = true
+		fields = append(fields, protoBytes(3, protoBytes(1, []byte(attr)), []byte{2 << 3, 1}))
+	}
+	return protoBytes(2, fields...)
+}
+
+func TestGeositeRules(t *testing.T) {
+	google := protoBytes(1,
+		protoBytes(1, []byte("GOOGLE")),
+		geositeDomainOf(geositePlain, "Google"),
+		geositeDomainOf(geositeRegex, `^ad[0-9]+\.google\.com$`),
+		geositeDomainOf(geositeDomain, "google.cn", "CN"),
+		geositeDomainOf(geositeFull, "www.google.com", "ads"),
+	)
+	other := protoBytes(1, protoBytes(1, []byte("other")), geositeDomainOf(geositeDomain, "example.com"))
+	geosite, err := ParseGeosite(slices.Concat(google, other))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := func(r FilterRule) string {
+		switch {
+		case r.Regex != nil:
+			return "regex:" + r.Regex.String()
+		case r.Keyword != "":
+			return "keyword:" + r.Keyword
+		case r.Exact:
+			return "full:" + r.Domain
+		default:
+			return "domain:" + r.Domain
+		}
+	}
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{"google", []string{"keyword:google", `regex:^ad[0-9]+\.google\.com$`, "domain:google.cn", "full:www.google.com"}},
+		{"Google@cn", []string{"domain:google.cn"}},
+		{"google@!cn", []string{"keyword:google", `regex:^ad[0-9]+\.google\.com$`, "full:www.google.com"}},
+		{"google@ads", []string{"full:www.google.com"}},
+		{"google@none", nil},
+		{"other", []string{"domain:example.com"}},
+	}
+	for _, tt := range tests {
+		rules, err := geosite.Rules(tt.category)
+		if err != nil {
+			t.Errorf("%s: %v", tt.category, err)
+			continue
+		}
+		var got []string
+		for _, r := range rules {
+			got = append(got, rule(r))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.category, got, tt.want)
+		}
+	}
+
+	if _, err := geosite.Rules("unknown"); !errors.Is(err, ErrGeositeCategory) {
+		t.Errorf("unknown category: %v", err)
+	}
+}
+
+func TestGeositeInvalid(t *testing.T) {
+	category := func(domains ...[]byte) []byte {
+		return protoBytes(1, append([][]byte{protoBytes(1, []byte("test"))}, domains...)...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"domain type", category(geositeDomainOf(4, "example.com"))},
+		{"regex", category(geositeDomainOf(geositeRegex, "("))},
+		{"truncated type", category(protoBytes(2, []byte{1 << 3}))},
+		{"overlong type", category(protoBytes(2, []byte{1 << 3, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))},
+		{"truncated attribute", category(protoBytes(2, []byte{3<<3 | 2, 5, 1<<3 | 2, 1}))},
+	}
+	for _, tt := range tests {
+		geosite, err := ParseGeosite(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if _, err := geosite.Rules("test"); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+
+	// every truncation of a valid file is an error
+	valid := category(geositeDomainOf(geositeFull, "www.example.com", "cn"))
+	for size := 1; size < len(valid); size++ {
+		geosite, err := ParseGeosite(valid[:size])
+		if err == nil {
+			_, err = geosite.Rules("test")
+		}
+		if !errors.Is(err, ErrGeositeFormat) {
+			t.Errorf("truncated to %d bytes: got %v", size, err)
+		}
+	}
+}
+
+func TestProtoFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		fields []int
+		valid  bool
+	}{
+		{"empty", nil, nil, true},
+		{"varint", []byte{1 << 3, 0x96, 0x01}, []int{1}, true},
+		{"64-bit", []byte{2<<3 | 1, 1, 2, 3, 4, 5, 6, 7, 8}, []int{2}, true},
+		{"32-bit", []byte{3<<3 | 5, 1, 2, 3, 4}, []int{3}, true},
+		{"bytes", []byte{4<<3 | 2, 2, 'o', 'k', 1 << 3, 1}, []int{4, 1}, true},
+		{"truncated key", []byte{0x80}, nil, false},
+		{"truncated varint", []byte{1 << 3, 0x96}, nil, false},
+		{"overlong varint", []byte{1 << 3, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, nil, false},
+		{"truncated 64-bit", []byte{2<<3 | 1, 1, 2, 3}, nil, false},
+		{"truncated 32-bit", []byte{3<<3 | 5, 1, 2}, nil, false},
+		{"truncated length", []byte{4<<3 | 2, 0x80}, nil, false},
+		{"truncated bytes", []byte{4<<3 | 2, 3, 'o', 'k'}, nil, false},
+		{"overlong length", []byte{4<<3 | 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 'o', 'k'}, nil, false},
+		{"wire type", []byte{1<<3 | 3}, nil, false},
+	}
+	for _, tt := range tests {
+		var fields []int
+		err := protoFields(tt.data, func(field int, value []byte) error {
+			fields = append(fields, field)
+			return nil
+		})
+		if tt.valid && (err != nil || !slices.Equal(fields, tt.fields)) {
+			t.Errorf("%s: got %v %v, want %v", tt.name, fields, err, tt.fields)
+		}
+		if !tt.valid && !errors.Is(err, ErrGeositeFormat) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrGeositeFormat)
+		}
+	}
+}
+
+func TestProtoVarint(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		value uint64
+		n     int
+	}{
+		{[]byte{0x01}, 1, 1},
+		{[]byte{0x96, 0x01, 0xff}, 150, 2},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, 1<<64 - 1, 10},
+		{nil, 0, 0},
+		{[]byte{0x96}, 0, 0},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, 0, 0},
+	}
+	for _, tt := range tests {
+		value, n := protoVarint(tt.data)
+		if value != tt.value || n != tt.n {
+			t.Errorf("%x: got %d %d, want %d %d", tt.data, value, n, tt.value, tt.n)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// punycode parameters, RFC 3492 section 5
+const (
+	punycodeBase        = 36
+	punycodeTmin        = 1
+	punycodeTmax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// asciiDomain lowercases the domain, the labels of an internationalized domain are converted to punycode.
+// It's not normalized by NFC.
+func asciiDomain(domain string) (string, bool) {
+	if !utf8.ValidString(domain) {
+		return "", false
+	}
+	labels := strings.Split(strings.ToLower(domain), ".")
+	for idx, label := range labels {
+		if isAscii(label) {
+			continue
+		}
+		labels[idx] = "xn--" + punycode(label)
+	}
+	return strings.Join(labels, "."), true
+}
+
+func isAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punycode encodes the label, RFC 3492 section 6.3.
+func punycode(label string) string {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for handled < len(runes) {
+		next := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < next {
+				next = r
+			}
+		}
+		delta += int(next-n) * (handled + 1)
+		n = next
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := min(max(k-bias, punycodeTmin), punycodeTmax)
+				if q < t {
+					break
+				}
+				out = append(out, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			out = append(out, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punycodeAdapt(delta int, points int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > (punycodeBase-punycodeTmin)*punycodeTmax/2 {
+		delta /= punycodeBase - punycodeTmin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTmin+1)*delta/(delta+punycodeSkew)
+}
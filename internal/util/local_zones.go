@@ -0,0 +1,47 @@
+package util
+
+import "strings"
+
+// LocalZones are the locally-served empty zones from RFC 6303 section 4.
+// Queries for them should never leak to public upstreams.
+var LocalZones = []string{
+	// RFC 1918
+	"10.in-addr.arpa.",
+	"16.172.in-addr.arpa.",
+	"17.172.in-addr.arpa.",
+	"18.172.in-addr.arpa.",
+	"19.172.in-addr.arpa.",
+	"20.172.in-addr.arpa.",
+	"21.172.in-addr.arpa.",
+	"22.172.in-addr.arpa.",
+	"23.172.in-addr.arpa.",
+	"24.172.in-addr.arpa.",
+	"25.172.in-addr.arpa.",
+	"26.172.in-addr.arpa.",
+	"27.172.in-addr.arpa.",
+	"28.172.in-addr.arpa.",
+	"29.172.in-addr.arpa.",
+	"30.172.in-addr.arpa.",
+	"31.172.in-addr.arpa.",
+	"168.192.in-addr.arpa.",
+	// RFC 5735 and RFC 5737
+	"0.in-addr.arpa.",
+	"127.in-addr.arpa.",
+	"254.169.in-addr.arpa.",
+	"2.0.192.in-addr.arpa.",
+	"100.51.198.in-addr.arpa.",
+	"113.0.203.in-addr.arpa.",
+	"255.255.255.255.in-addr.arpa.",
+	// RFC 4291, unspecified and loopback address
+	strings.Repeat("0.", 32) + "ip6.arpa.",
+	"1." + strings.Repeat("0.", 31) + "ip6.arpa.",
+	// RFC 4193, unique local address
+	"d.f.ip6.arpa.",
+	// RFC 4291, link-local address
+	"8.e.f.ip6.arpa.",
+	"9.e.f.ip6.arpa.",
+	"a.e.f.ip6.arpa.",
+	"b.e.f.ip6.arpa.",
+	// RFC 3849, documentation address
+	"8.b.d.0.1.0.0.2.ip6.arpa.",
+}
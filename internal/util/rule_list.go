@@ -0,0 +1,312 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const CHINA_LIST_URL = "https://raw.githubusercontent.com/felixonmars/dnsmasq-china-list/master/accelerated-domains.china.conf"
+
+var (
+	ErrRuleListFormat      = errors.New("unsupported rule list format")
+	ErrRuleListSyntax      = errors.New("invalid rule list line")
+	ErrRuleListEmpty       = errors.New("empty rule list")
+	ErrRuleListNotModified = errors.New("rule list not modified")
+)
+
+// RemoteList downloads a rule list.
+// If the cacheDir is set, the list is saved to disk and revalidated with conditional requests.
+type RemoteList struct {
+	ctx        context.Context
+	httpClient *http.Client
+	validator  remoteListValidator
+	url        string
+	cacheDir   string
+}
+
+type remoteListValidator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func MakeRemoteList(ctx context.Context, url string, proxy string, cacheDir string) *RemoteList {
+	return &RemoteList{
+		ctx:        ctx,
+		httpClient: makeHttpClient(proxy),
+		url:        url,
+		cacheDir:   cacheDir,
+	}
+}
+
+// Fetch downloads the list.
+// It returns ErrRuleListNotModified if the list is the same as the last fetched or cached one.
+func (l *RemoteList) Fetch(format string) ([]FilterRule, error) {
+	logger := zerolog.Ctx(l.ctx).
+		With().
+		Str("module", "rule_list").
+		Str("url", l.url).
+		Logger()
+
+	req, err := http.NewRequestWithContext(l.ctx, "GET", l.url, http.NoBody)
+	if err != nil {
+		err = errors.WithStack(err)
+		logger.Error().Err(err).Msg("failed to create request")
+		return nil, err
+	}
+	if l.validator.ETag != "" {
+		req.Header.Set("If-None-Match", l.validator.ETag)
+	}
+	if l.validator.LastModified != "" {
+		req.Header.Set("If-Modified-Since", l.validator.LastModified)
+	}
+
+	logger.Trace().Msg("fetching rule list")
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		err = errors.WithStack(err)
+		logger.Error().Err(err).Msg("failed to send request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		logger.Trace().Msg("not modified")
+		return nil, ErrRuleListNotModified
+	}
+	if resp.StatusCode != 200 {
+		err = errors.Errorf("unexpected status code %d", resp.StatusCode)
+		logger.Error().Err(err).Int("StatusCode", resp.StatusCode).Msg("StatusCode")
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = errors.WithStack(err)
+		logger.Error().Err(err).Msg("failed to read response")
+		return nil, err
+	}
+	rules, err := ParseRuleList(bytes.NewReader(body), format)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, ErrRuleListEmpty
+	}
+
+	l.validator = remoteListValidator{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := l.saveCache(body); err != nil {
+		logger.Error().Err(err).Msg("failed to save cache")
+	}
+
+	return rules, nil
+}
+
+// LoadCache loads the list saved by the last Fetch.
+func (l *RemoteList) LoadCache(format string) ([]FilterRule, error) {
+	if l.cacheDir == "" {
+		return nil, nil
+	}
+	listPath, metaPath := l.cachePath()
+
+	rules, err := LoadRuleList(listPath, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, ErrRuleListEmpty
+	}
+
+	var validator remoteListValidator
+	if meta, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(meta, &validator)
+	}
+	l.validator = validator
+
+	return rules, nil
+}
+
+func (l *RemoteList) saveCache(body []byte) error {
+	if l.cacheDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(l.cacheDir, 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	listPath, metaPath := l.cachePath()
+
+	meta, err := json.Marshal(l.validator)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := writeFileAtomic(listPath, body); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, meta)
+}
+
+func (l *RemoteList) cachePath() (string, string) {
+	hash := sha256.Sum256([]byte(l.url))
+	name := hex.EncodeToString(hash[:8])
+	return filepath.Join(l.cacheDir, name+".list"), filepath.Join(l.cacheDir, name+".json")
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(f.Name(), path))
+}
+
+// LoadRuleList loads a rule list from a local file.
+func LoadRuleList(path string, format string) ([]FilterRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	rules, err := ParseRuleList(f, format)
+	if err != nil {
+		return nil, errors.WithMessage(err, path)
+	}
+	return rules, nil
+}
+
+// ParseRuleList parses a rule list.
+// The format is one of "adblock", "dnsmasq" and "domain".
+func ParseRuleList(r io.Reader, format string) ([]FilterRule, error) {
+	switch format {
+	case "adblock":
+		rules, _, err := ParseFilterList(r)
+		return rules, err
+	case "dnsmasq":
+		return parseDnsmasqList(r)
+	case "domain":
+		return parseDomainList(r)
+	default:
+		return nil, errors.Wrap(ErrRuleListFormat, format)
+	}
+}
+
+// parseDnsmasqList parses "server=/example.com/114.114.114.114" and "ipset=/example.com/setname".
+// Other dnsmasq options are ignored.
+func parseDnsmasqList(r io.Reader) ([]FilterRule, error) {
+	var rules []FilterRule
+	lineNum := 0
+	buf := bufio.NewScanner(r)
+	for buf.Scan() {
+		lineNum++
+		line := strings.TrimSpace(buf.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "server", "local", "address", "ipset", "nftset":
+		default:
+			continue
+		}
+		fields := strings.Split(value, "/")
+		if fields[0] != "" {
+			// server=114.114.114.114, not for a domain
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, syntaxError(lineNum, line)
+		}
+		for _, domain := range fields[1 : len(fields)-1] {
+			if domain == "" {
+				continue
+			}
+			domain, ok := parseListDomain(domain)
+			if !ok {
+				return nil, syntaxError(lineNum, line)
+			}
+			rules = append(rules, FilterRule{Domain: domain})
+		}
+	}
+	return rules, errors.WithStack(buf.Err())
+}
+
+// parseDomainList parses a domain per line, subdomains are matched
+func parseDomainList(r io.Reader) ([]FilterRule, error) {
+	var rules []FilterRule
+	lineNum := 0
+	buf := bufio.NewScanner(r)
+	for buf.Scan() {
+		lineNum++
+		line := buf.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		domain, ok := parseListDomain(line)
+		if !ok {
+			return nil, syntaxError(lineNum, line)
+		}
+		rules = append(rules, FilterRule{Domain: domain})
+	}
+	return rules, errors.WithStack(buf.Err())
+}
+
+// parseListDomain lowercases the domain, without the trailing dot, an IDN is converted to punycode.
+func parseListDomain(domain string) (string, bool) {
+	domain, ok := asciiDomain(strings.TrimSuffix(domain, "."))
+	if !ok || !isPlainDomain(domain) {
+		return "", false
+	}
+	if _, ok := dns.IsDomainName(domain); !ok {
+		return "", false
+	}
+	return domain, true
+}
+
+func syntaxError(lineNum int, line string) error {
+	return errors.Wrapf(ErrRuleListSyntax, "line %d: %q", lineNum, line)
+}
+
+func makeHttpClient(proxy string) *http.Client {
+	httpClient := new(http.Client)
+	if proxy != "" {
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil {
+			panic(err)
+		}
+		httpClient.Transport = &http.Transport{
+			Proxy: http.ProxyURL(proxyUrl),
+		}
+	}
+	return httpClient
+}
@@ -0,0 +1,217 @@
+package util
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func domainsOf(rules []FilterRule) []string {
+	var domains []string
+	for _, rule := range rules {
+		domains = append(domains, rule.Domain)
+	}
+	return domains
+}
+
+func TestParseDnsmasqList(t *testing.T) {
+	list := `# comment
+server=/example.com/114.114.114.114
+
+  server=/a.example.org/b.example.org/114.114.114.114
+server=114.114.114.114
+ipset=/Example.NET./setname
+nftset=/example.io/4#inet#fw4#set
+cache-size=1000
+no-resolv
+`
+	rules, err := parseDnsmasqList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"example.com", "a.example.org", "b.example.org", "example.net", "example.io"}
+	if got := domainsOf(rules); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	invalid := []struct {
+		list string
+		line string
+	}{
+		{"server=/example.com/1.1.1.1\nserver=/example.com\n", `line 2: "server=/example.com"`},
+		{"# comment\n\nserver=/exa mple.com/1.1.1.1\n", `line 3: "server=/exa mple.com/1.1.1.1"`},
+		{"ipset=/*.example.com/setname\n", `line 1: "ipset=/*.example.com/setname"`},
+	}
+	for _, tt := range invalid {
+		_, err := parseDnsmasqList(strings.NewReader(tt.list))
+		if !errors.Is(err, ErrRuleListSyntax) || !strings.Contains(err.Error(), tt.line) {
+			t.Errorf("%q: got %v, want %s", tt.list, err, tt.line)
+		}
+	}
+}
+
+func TestParseDomainList(t *testing.T) {
+	list := `# comment
+example.com
+  Example.ORG.  # trailing comment
+
+xn--fiqs8s
+中国
+`
+	rules, err := parseDomainList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"example.com", "example.org", "xn--fiqs8s", "xn--fiqs8s"}
+	if got := domainsOf(rules); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	invalid := []struct {
+		list string
+		line string
+	}{
+		{"example.com\nhttp://example.org\n", `line 2: "http://example.org"`},
+		{"example.com\n\n# comment\n*.example.org\n", `line 4: "*.example.org"`},
+		{"example..com\n", `line 1: "example..com"`},
+	}
+	for _, tt := range invalid {
+		_, err := parseDomainList(strings.NewReader(tt.list))
+		if !errors.Is(err, ErrRuleListSyntax) || !strings.Contains(err.Error(), tt.line) {
+			t.Errorf("%q: got %v, want %s", tt.list, err, tt.line)
+		}
+	}
+}
+
+func TestParseListDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+		valid  bool
+	}{
+		{"example.com", "example.com", true},
+		{"Example.COM.", "example.com", true},
+		{"_dmarc.example.com", "_dmarc.example.com", true},
+		{"例子.中国", "xn--fsqu00a.xn--fiqs8s", true},
+		{"Bücher.example", "xn--bcher-kva.example", true},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de", true},
+		{"", "", false},
+		{".", "", false},
+		{"example..com", "", false},
+		{"*.example.com", "", false},
+		{"example.com/path", "", false},
+		{"\xff.example.com", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseListDomain(tt.domain)
+		if got != tt.want || ok != tt.valid {
+			t.Errorf("%q: got %q %v, want %q %v", tt.domain, got, ok, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestRemoteListCache(t *testing.T) {
+	var (
+		body        = "example.com\n"
+		etag        = `"v1"`
+		ifNoneMatch string
+		ifModified  string
+	)
+	const lastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = r.Header.Get("If-None-Match")
+		ifModified = r.Header.Get("If-Modified-Since")
+		if ifNoneMatch == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		_, _ = io.WriteString(w, body)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	list := MakeRemoteList(context.Background(), server.URL, "", dir)
+	rules, err := list.Fetch("domain")
+	if err != nil || !slices.Equal(domainsOf(rules), []string{"example.com"}) {
+		t.Fatalf("first fetch: %v %v", rules, err)
+	}
+	if ifNoneMatch != "" || ifModified != "" {
+		t.Errorf("conditional headers without cache: %q %q", ifNoneMatch, ifModified)
+	}
+
+	// restarted, the cached list is revalidated
+	list = MakeRemoteList(context.Background(), server.URL, "", dir)
+	rules, err = list.LoadCache("domain")
+	if err != nil || !slices.Equal(domainsOf(rules), []string{"example.com"}) {
+		t.Fatalf("load cache: %v %v", rules, err)
+	}
+	if _, err := list.Fetch("domain"); !errors.Is(err, ErrRuleListNotModified) {
+		t.Errorf("not modified: %v", err)
+	}
+	if ifNoneMatch != etag || ifModified != lastModified {
+		t.Errorf("conditional headers: %q %q", ifNoneMatch, ifModified)
+	}
+
+	// a new list rewrites the cache
+	body, etag = "example.org\n", `"v2"`
+	rules, err = list.Fetch("domain")
+	if err != nil || !slices.Equal(domainsOf(rules), []string{"example.org"}) {
+		t.Fatalf("modified: %v %v", rules, err)
+	}
+	listPath, metaPath := list.cachePath()
+	if data, _ := os.ReadFile(listPath); string(data) != body {
+		t.Errorf("cached list: %q", data)
+	}
+	if data, _ := os.ReadFile(metaPath); !strings.Contains(string(data), `\"v2\"`) {
+		t.Errorf("cached validator: %s", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("temporary files are left: %v", entries)
+	}
+
+	// without network, the list is loaded from the cache
+	server.Close()
+	list = MakeRemoteList(context.Background(), server.URL, "", dir)
+	rules, err = list.LoadCache("domain")
+	if err != nil || !slices.Equal(domainsOf(rules), []string{"example.org"}) {
+		t.Fatalf("load cache offline: %v %v", rules, err)
+	}
+	if _, err := list.Fetch("domain"); err == nil {
+		t.Error("fetched offline")
+	}
+}
+
+func TestRemoteListInvalid(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "# nothing\n")
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	// an empty list is not cached
+	list := MakeRemoteList(context.Background(), server.URL, "", dir)
+	if _, err := list.Fetch("domain"); !errors.Is(err, ErrRuleListEmpty) {
+		t.Errorf("empty list: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("cached: %v", entries)
+	}
+	if _, err := list.LoadCache("domain"); err == nil {
+		t.Error("no cache")
+	}
+
+	// without cache dir, there is nothing to load
+	list = MakeRemoteList(context.Background(), server.URL, "", "")
+	if rules, err := list.LoadCache("domain"); rules != nil || err != nil {
+		t.Errorf("no cache dir: %v %v", rules, err)
+	}
+}